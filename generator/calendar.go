@@ -0,0 +1,139 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+const DATE_LAYOUT = "20060102" // GTFS date layout, see go doc
+
+// ServiceCalendar resolves on which weekdays a service runs. Without
+// dates only the weekday flags of calendar.txt are used, with dates the
+// calendar.txt date ranges and calendar_dates.txt exceptions decide on
+// which of the given dates a service runs.
+type ServiceCalendar struct {
+	feed   *gtfs.Feed
+	dates  []time.Time
+	ranges map[string]calendarRange
+	cache  map[string]int32
+}
+
+type calendarRange struct {
+	weekdays  int32
+	startDate int
+	endDate   int
+}
+
+func NewServiceCalendar(path string, feed *gtfs.Feed, dates []time.Time) (*ServiceCalendar, error) {
+	calendar := &ServiceCalendar{
+		feed:  feed,
+		dates: dates,
+		cache: make(map[string]int32),
+	}
+	if len(dates) == 0 {
+		return calendar, nil
+	}
+	ranges, err := readCalendarRanges(path)
+	if err != nil {
+		return nil, err
+	}
+	calendar.ranges = ranges
+	return calendar, nil
+}
+
+// readCalendarRanges reads weekdays and date range of every service in
+// calendar.txt of the feed at path
+func readCalendarRanges(path string) (map[string]calendarRange, error) {
+	ranges := make(map[string]calendarRange)
+	_, err := readGtfsCsv(path, "calendar.txt", func(row map[string]string) error {
+		var weekdays int32
+		for i, day := range []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"} {
+			if row[day] == "1" {
+				weekdays = weekdays | (1 << uint(i))
+			}
+		}
+		startDate, err := strconv.Atoi(row["start_date"])
+		if err != nil {
+			return fmt.Errorf("invalid start_date %q for service %s", row["start_date"], row["service_id"])
+		}
+		endDate, err := strconv.Atoi(row["end_date"])
+		if err != nil {
+			return fmt.Errorf("invalid end_date %q for service %s", row["end_date"], row["service_id"])
+		}
+		ranges[row["service_id"]] = calendarRange{weekdays, startDate, endDate}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// HasDates reports whether services are resolved for specific dates
+func (c *ServiceCalendar) HasDates() bool {
+	return len(c.dates) > 0
+}
+
+// RunsOn reports whether a service runs on date according to
+// calendar.txt and calendar_dates.txt
+func (c *ServiceCalendar) RunsOn(serviceId string, date time.Time) bool {
+	day := dateToInt(date)
+	for _, calendardate := range c.feed.CalendarDates[serviceId] {
+		if calendardate.Date != day {
+			continue
+		}
+		if calendardate.ExceptionType == 1 {
+			return true
+		}
+		if calendardate.ExceptionType == 2 {
+			return false
+		}
+	}
+	r, ok := c.ranges[serviceId]
+	if !ok {
+		return false
+	}
+	return day >= r.startDate && day <= r.endDate && r.weekdays&weekdayBit(date.Weekday()) != 0
+}
+
+// Weekdays returns the bitmask of weekdays a service runs on, with
+// dates only the weekdays of dates the service runs on are set
+func (c *ServiceCalendar) Weekdays(serviceId string) int32 {
+	weekdays, ok := c.cache[serviceId]
+	if ok {
+		return weekdays
+	}
+	if !c.HasDates() {
+		weekdays = GetWeekdaysForServiceId(c.feed, serviceId)
+	} else {
+		for _, date := range c.dates {
+			if c.RunsOn(serviceId, date) {
+				weekdays = weekdays | weekdayBit(date.Weekday())
+			}
+		}
+	}
+	c.cache[serviceId] = weekdays
+	return weekdays
+}
+
+// weekdayBit converts a time.Weekday (Sunday first) to a bit in the
+// Monday-first weekday bitmask
+func weekdayBit(wd time.Weekday) int32 {
+	if wd == time.Sunday {
+		return 1 << 6
+	}
+	return 1 << (uint(wd) - 1)
+}
+
+// dateToInt converts a date to its GTFS integer form YYYYMMDD
+func dateToInt(date time.Time) int {
+	return date.Year()*10000 + int(date.Month())*100 + date.Day()
+}
+
+// parseDateInt converts a GTFS integer date YYYYMMDD to a time
+func parseDateInt(day int) (time.Time, error) {
+	return time.Parse(DATE_LAYOUT, strconv.Itoa(day))
+}
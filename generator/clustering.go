@@ -0,0 +1,195 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+const EARTH_RADIUS = 6371000.0 // meters
+
+// StopCluster is a group of GTFS stops that become one Mapnificent stop
+type StopCluster struct {
+	Key string
+	Lat float64
+	Lon float64
+}
+
+// StopClusters assigns every stop of all feeds to a cluster
+type StopClusters struct {
+	clusterOf map[string]*StopCluster
+}
+
+// Get returns the cluster of a stop or nil for unknown stops
+func (c *StopClusters) Get(path string, stopId string) *StopCluster {
+	return c.clusterOf[fmt.Sprintf("%s_%s", path, stopId)]
+}
+
+// sortedFeedPaths returns the feed paths sorted by feed id, which unlike
+// the paths of unpacked feeds is the same on every run
+func sortedFeedPaths(feeds map[string]*gtfs.Feed, ids FeedIds) []string {
+	paths := make([]string, 0, len(feeds))
+	for path := range feeds {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if ids.Id(paths[i]) != ids.Id(paths[j]) {
+			return ids.Id(paths[i]) < ids.Id(paths[j])
+		}
+		return paths[i] < paths[j]
+	})
+	return paths
+}
+
+func sortedStopIds(feed *gtfs.Feed) []string {
+	stopIds := make([]string, 0, len(feed.Stops))
+	for stopId := range feed.Stops {
+		stopIds = append(stopIds, stopId)
+	}
+	sort.Strings(stopIds)
+	return stopIds
+}
+
+// haversine returns the distance in meters between two coordinates
+func haversine(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EARTH_RADIUS * math.Asin(math.Sqrt(a))
+}
+
+// ClusterStops groups the stops of the index. Stops within radius meters
+// are clustered transitively, as long as the cluster does not spread wider
+// than twice the radius, so that dense areas do not chain into one huge
+// stop. With a hierarchy stops of the same station form a cluster and only
+// stops without a station are clustered by radius. Platforms of stations
+// with pathways are never merged, in-station transfers connect them
+// instead. Stops are processed in index order, sorted by feed id and stop
+// id, so the result does not depend on map iteration order.
+func ClusterStops(index *StopIndex, hierarchy StopHierarchy, pathways *StationPathways, radius float64) *StopClusters {
+	type member struct {
+		key     string
+		path    string
+		stop    *gtfs.Stop
+		station *StopStation
+		// Platform of a station with pathways
+		separate bool
+	}
+	type bounds struct {
+		minLat, maxLat, minLon, maxLon float64
+	}
+
+	members := make([]member, len(index.Stops))
+	for i, indexed := range index.Stops {
+		path, stopId := indexed.Path, indexed.Stop.Id
+		key := fmt.Sprintf("%s_%s", path, stopId)
+		if pathways.IsSeparate(path, stopId) {
+			members[i] = member{key, path, indexed.Stop, nil, true}
+		} else {
+			members[i] = member{key, path, indexed.Stop, hierarchy.GetStation(path, stopId), false}
+		}
+	}
+
+	parent := make([]int, len(members))
+	extent := make([]bounds, len(members))
+	for i, m := range members {
+		parent[i] = i
+		extent[i] = bounds{m.stop.Lat, m.stop.Lat, m.stop.Lon, m.stop.Lon}
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	// union merges the clusters of i and j with the lower index as root
+	union := func(i int, j int, limitExtent bool) {
+		a, b := find(i), find(j)
+		if a == b {
+			return
+		}
+		if b < a {
+			a, b = b, a
+		}
+		merged := bounds{
+			math.Min(extent[a].minLat, extent[b].minLat), math.Max(extent[a].maxLat, extent[b].maxLat),
+			math.Min(extent[a].minLon, extent[b].minLon), math.Max(extent[a].maxLon, extent[b].maxLon),
+		}
+		if limitExtent && haversine(merged.minLat, merged.minLon, merged.maxLat, merged.maxLon) > 2*radius {
+			return
+		}
+		parent[b] = a
+		extent[a] = merged
+	}
+
+	stationMembers := make(map[string]int)
+	for i, m := range members {
+		if m.separate {
+			continue
+		}
+		if m.station != nil {
+			stationKey := fmt.Sprintf("%s_%s", m.path, m.station.Id)
+			if j, ok := stationMembers[stationKey]; ok {
+				union(i, j, false)
+			} else {
+				stationMembers[stationKey] = i
+			}
+			continue
+		}
+		nearby := make([]int, 0)
+		for _, nearbyStop := range index.Within(m.stop.Lat, m.stop.Lon, radius) {
+			j := nearbyStop.index
+			if j == i || members[j].station != nil || members[j].separate {
+				continue
+			}
+			nearby = append(nearby, j)
+		}
+		sort.Ints(nearby)
+		for _, j := range nearby {
+			union(i, j, true)
+		}
+	}
+
+	clusters := &StopClusters{clusterOf: make(map[string]*StopCluster, len(members))}
+	roots := make(map[int]*StopCluster)
+	counts := make(map[int]int)
+	for i, m := range members {
+		root := find(i)
+		cluster, ok := roots[root]
+		if !ok {
+			cluster = &StopCluster{Key: "cluster_" + members[root].key}
+			roots[root] = cluster
+		}
+		// Centroid of the members
+		counts[root] += 1
+		cluster.Lat += (m.stop.Lat - cluster.Lat) / float64(counts[root])
+		cluster.Lon += (m.stop.Lon - cluster.Lon) / float64(counts[root])
+		clusters.clusterOf[m.key] = cluster
+	}
+	for root, cluster := range roots {
+		station := members[root].station
+		if station != nil && (station.Lat != 0 || station.Lon != 0) {
+			cluster.Lat = station.Lat
+			cluster.Lon = station.Lon
+		}
+	}
+	return clusters
+}
+
+// GetStopsBoundingBox returns the box around the stops of all feeds
+func GetStopsBoundingBox(feeds map[string]*gtfs.Feed) BoundingBox {
+	bbox := BoundingBox{math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)}
+	for _, feed := range feeds {
+		for _, stop := range feed.Stops {
+			bbox.MinLat = math.Min(bbox.MinLat, stop.Lat)
+			bbox.MaxLat = math.Max(bbox.MaxLat, stop.Lat)
+			bbox.MinLon = math.Min(bbox.MinLon, stop.Lon)
+			bbox.MaxLon = math.Max(bbox.MaxLon, stop.Lon)
+		}
+	}
+	return bbox
+}
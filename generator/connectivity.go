@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+// SymmetrizeWalks adds a walk in the opposite direction with the same
+// distance or time for every walk without one, so that every walk can be
+// taken both ways. Walks are only searched from stops served by a trip.
+// Returns the number of walks added.
+func SymmetrizeWalks(network *mapnificent.MapnificentNetwork) int {
+	walks := make(map[[2]uint32]bool)
+	for i, mapnificentStop := range network.Stops {
+		for _, travelOption := range mapnificentStop.TravelOptions {
+			if isWalk(travelOption) {
+				walks[[2]uint32{uint32(i), travelOption.Stop}] = true
+			}
+		}
+	}
+	added := 0
+	for i, mapnificentStop := range network.Stops {
+		for _, travelOption := range mapnificentStop.TravelOptions {
+			reverse := [2]uint32{travelOption.Stop, uint32(i)}
+			if !isWalk(travelOption) || walks[reverse] {
+				continue
+			}
+			walks[reverse] = true
+			reverseOption := new(mapnificent.MapnificentNetwork_Stop_TravelOption)
+			reverseOption.Stop = uint32(i)
+			reverseOption.WalkDistance = travelOption.WalkDistance
+			reverseOption.WalkTime = travelOption.WalkTime
+			toStop := network.Stops[travelOption.Stop]
+			toStop.TravelOptions = append(toStop.TravelOptions, reverseOption)
+			added += 1
+		}
+	}
+	return added
+}
+
+// FindDeadEnds returns the indexes of the stops without any travel option,
+// they can be reached but not left
+func FindDeadEnds(network *mapnificent.MapnificentNetwork) []int {
+	deadEnds := make([]int, 0)
+	for i, mapnificentStop := range network.Stops {
+		if len(mapnificentStop.TravelOptions) == 0 {
+			deadEnds = append(deadEnds, i)
+		}
+	}
+	return deadEnds
+}
+
+// RemoveDeadEnds removes the dead end stops together with the travel
+// options leading to them. Stops left without travel options by that are
+// not removed in turn, as they still lead somewhere a traveller may want
+// to go. Travel options are renumbered to the remaining stops. Returns the
+// number of stops and travel options removed.
+func RemoveDeadEnds(network *mapnificent.MapnificentNetwork) (stops int, travelOptions int) {
+	removed := make(map[uint32]bool)
+	for _, i := range FindDeadEnds(network) {
+		removed[uint32(i)] = true
+	}
+	if len(removed) == 0 {
+		return 0, 0
+	}
+
+	newIndex := make([]uint32, len(network.Stops))
+	remaining := make([]*mapnificent.MapnificentNetwork_Stop, 0, len(network.Stops)-len(removed))
+	for i, mapnificentStop := range network.Stops {
+		if removed[uint32(i)] {
+			continue
+		}
+		newIndex[i] = uint32(len(remaining))
+		remaining = append(remaining, mapnificentStop)
+	}
+	for _, mapnificentStop := range remaining {
+		travelOptions += filterTravelOptions(mapnificentStop, func(travelOption *mapnificent.MapnificentNetwork_Stop_TravelOption) bool {
+			return !removed[travelOption.Stop]
+		})
+		for _, travelOption := range mapnificentStop.TravelOptions {
+			travelOption.Stop = newIndex[travelOption.Stop]
+		}
+	}
+	network.Stops = remaining
+	return len(removed), travelOptions
+}
@@ -0,0 +1,40 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+func TestRemoveDeadEnds(t *testing.T) {
+	option := func(stop uint32, line string) *mapnificent.MapnificentNetwork_Stop_TravelOption {
+		return &mapnificent.MapnificentNetwork_Stop_TravelOption{Stop: stop, Line: line}
+	}
+	// 0 -> 1 -> 2 is a line ending in the dead end 2, 3 is isolated and
+	// 4 only leads to 2
+	network := &mapnificent.MapnificentNetwork{Stops: []*mapnificent.MapnificentNetwork_Stop{
+		{Name: "0", TravelOptions: []*mapnificent.MapnificentNetwork_Stop_TravelOption{option(1, "L")}},
+		{Name: "1", TravelOptions: []*mapnificent.MapnificentNetwork_Stop_TravelOption{option(2, "L"), option(4, "")}},
+		{Name: "2"},
+		{Name: "3"},
+		{Name: "4", TravelOptions: []*mapnificent.MapnificentNetwork_Stop_TravelOption{option(2, "M")}},
+	}}
+	if deadEnds := FindDeadEnds(network); len(deadEnds) != 2 || deadEnds[0] != 2 || deadEnds[1] != 3 {
+		t.Fatalf("got dead ends %v, want [2 3]", deadEnds)
+	}
+	stops, travelOptions := RemoveDeadEnds(network)
+	if stops != 2 || travelOptions != 2 {
+		t.Errorf("removed %d stops and %d travel options, want 2 each", stops, travelOptions)
+	}
+	if len(network.Stops) != 3 {
+		t.Fatalf("got %d stops, want 3", len(network.Stops))
+	}
+	// Stop 4 is renumbered and kept without travel options
+	stop1 := network.Stops[1]
+	if stop1.Name != "1" || len(stop1.TravelOptions) != 1 || stop1.TravelOptions[0].Stop != 2 {
+		t.Errorf("got travel options %v of stop 1, want the walk to stop 4 at index 2", stop1.TravelOptions)
+	}
+	if stop4 := network.Stops[2]; stop4.Name != "4" || len(stop4.TravelOptions) != 0 {
+		t.Errorf("got stop %s with %d travel options, want stop 4 without", stop4.Name, len(stop4.TravelOptions))
+	}
+}
@@ -0,0 +1,366 @@
+package generator
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// Archives inside archives are unpacked up to this depth
+const MAX_ARCHIVE_DEPTH = 3
+
+// SkippedPath is a file or directory that was not loaded as a feed
+type SkippedPath struct {
+	Path   string
+	Reason string
+}
+
+// Discovery collects the feeds of feed sources and the reasons why other
+// files and directories were skipped. Include and exclude are glob
+// patterns matched against the path relative to a searched directory, or
+// against the name only for patterns without a slash. Excluded
+// directories are not searched, feeds have to match an include pattern
+// if there are any. The patterns do not apply inside archives.
+type Discovery struct {
+	Include []string
+	Exclude []string
+	// Files written by the sources go below Dir
+	Dir string
+
+	Feeds   []string
+	Skipped []SkippedPath
+	// Feeds found and paths skipped are logged here
+	Logger *log.Logger
+
+	// Where the feeds come from, for feeds unpacked from archives
+	origins map[string]string
+	ids     FeedIds
+	// Directory of the path being searched, feed ids are relative to it
+	root string
+	// Directories and archives seen, to find symlink loops and feeds
+	// reached through more than one symlink
+	visited []os.FileInfo
+}
+
+func NewDiscovery(include []string, exclude []string, dir string) *Discovery {
+	return &Discovery{
+		Include: include,
+		Exclude: exclude,
+		Dir:     dir,
+		Feeds:   make([]string, 0),
+		Skipped: make([]SkippedPath, 0),
+		Logger:  log.New(io.Discard, "", 0),
+		origins: make(map[string]string),
+		ids:     make(FeedIds),
+	}
+}
+
+// FeedIds maps feed path to a stable and unique id of the feed, which
+// does not depend on where feeds are unpacked to
+type FeedIds map[string]string
+
+// Id returns the id of the feed at path, its path if it has none
+func (ids FeedIds) Id(path string) string {
+	if id, ok := ids[path]; ok {
+		return id
+	}
+	return path
+}
+
+// FeedIds returns the ids of the feeds found: their origin relative to
+// the directory of the searched path, like "feeds/berlin.zip" or
+// "bundle.tar.gz/berlin", or the name of the source for readers and URLs.
+// Ids that would be the same get a "#2", "#3" etc. suffix.
+func (d *Discovery) FeedIds() FeedIds {
+	return d.ids
+}
+
+// Origin names where the feed at path comes from: its path, or the path
+// of the archive it was unpacked from followed by its path in the archive
+func (d *Discovery) Origin(path string) string {
+	if origin, ok := d.origins[path]; ok {
+		return origin
+	}
+	return path
+}
+
+func (d *Discovery) addFeed(path string, origin string) {
+	d.Logger.Println("Found feed", origin)
+	d.Feeds = append(d.Feeds, path)
+	if origin != path {
+		d.origins[path] = origin
+	}
+	id := origin
+	if d.root != "" {
+		if rel, err := filepath.Rel(d.root, origin); err == nil {
+			id = filepath.ToSlash(rel)
+		}
+	}
+	unique := id
+	for n := 2; d.idUsed(unique); n++ {
+		unique = fmt.Sprintf("%s#%d", id, n)
+	}
+	d.ids[path] = unique
+}
+
+func (d *Discovery) idUsed(id string) bool {
+	for _, used := range d.ids {
+		if used == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Discovery) skip(origin string, reason string) {
+	d.Logger.Println("Skipping", origin+":", reason)
+	d.Skipped = append(d.Skipped, SkippedPath{Path: origin, Reason: reason})
+}
+
+// seen tells whether the file or directory was visited before and marks
+// it as visited
+func (d *Discovery) seen(fileInfo os.FileInfo) bool {
+	for _, visited := range d.visited {
+		if os.SameFile(visited, fileInfo) {
+			return true
+		}
+	}
+	d.visited = append(d.visited, fileInfo)
+	return false
+}
+
+// Search adds the feeds at path, a feed directory, an archive or a
+// directory that is searched recursively. Symlinks are followed.
+func (d *Discovery) Search(ctx context.Context, path string) error {
+	d.Logger.Println("Searching", path)
+	path = filepath.Clean(path)
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	d.root = filepath.Dir(path)
+	defer func() { d.root = "" }()
+	return d.search(ctx, path, path, "", 0)
+}
+
+// search adds the feeds at path, which is called origin in messages and
+// is found at rel below the searched directory. Filters only apply to
+// paths outside of archives, at depth 0.
+func (d *Discovery) search(ctx context.Context, path string, origin string, rel string, depth int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if depth == 0 && rel != "" {
+		if pattern, ok := matchPatterns(d.Exclude, rel); ok {
+			d.skip(origin, "excluded by "+pattern)
+			return nil
+		}
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		// Broken symlink or no permission
+		d.skip(origin, err.Error())
+		return nil
+	}
+	if !fileInfo.IsDir() {
+		if rel != "" && !isArchivePath(path) {
+			// Other files in a directory are not feeds
+			return nil
+		}
+		if !d.included(rel, depth) {
+			d.skip(origin, "not matched by an include pattern")
+			return nil
+		}
+		if d.seen(fileInfo) {
+			d.skip(origin, "already found, second link to it")
+			return nil
+		}
+		return d.addArchive(ctx, path, origin, depth)
+	}
+	if d.seen(fileInfo) {
+		d.skip(origin, "directory already searched, symlink loop or second link to it")
+		return nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		d.skip(origin, err.Error())
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(missingFeedFiles(names)) == 0 {
+		if d.included(rel, depth) {
+			d.addFeed(path, origin)
+		} else {
+			d.skip(origin, "not matched by an include pattern")
+		}
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && entry.Type()&os.ModeSymlink == 0 && !isArchivePath(name) {
+			continue
+		}
+		childRel := name
+		if rel != "" {
+			childRel = rel + "/" + name
+		}
+		if err := d.search(ctx, filepath.Join(path, name), origin+"/"+name, childRel, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Discovery) included(rel string, depth int) bool {
+	if depth > 0 || rel == "" || len(d.Include) == 0 {
+		return true
+	}
+	_, ok := matchPatterns(d.Include, rel)
+	return ok
+}
+
+// addArchive adds the feeds in the archive at path. The contents of tar
+// files are unpacked below Dir and searched for feeds.
+func (d *Discovery) addArchive(ctx context.Context, path string, origin string, depth int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if depth > MAX_ARCHIVE_DEPTH {
+		d.skip(origin, fmt.Sprintf("archives nested deeper than %d", MAX_ARCHIVE_DEPTH))
+		return nil
+	}
+	format, err := sniffArchive(path)
+	if err != nil {
+		d.skip(origin, err.Error())
+		return nil
+	}
+	switch format {
+	case ARCHIVE_ZIP:
+		return d.addZip(ctx, path, origin, depth)
+	case ARCHIVE_TAR, ARCHIVE_TAR_GZ:
+		out, err := os.MkdirTemp(d.Dir, "tar")
+		if err != nil {
+			return err
+		}
+		if err := extractTar(path, format, out, d.Logger); err != nil {
+			d.skip(origin, "broken tar file: "+err.Error())
+			return nil
+		}
+		return d.search(ctx, out, origin, "", depth+1)
+	}
+	d.skip(origin, "not a zip, tar or tar.gz file")
+	return nil
+}
+
+// addZip adds a zip file with the GTFS files as a feed. Zip files inside
+// a zip file without them are unpacked below Dir and added.
+func (d *Discovery) addZip(ctx context.Context, path string, origin string, depth int) error {
+	zipReader, err := zip.OpenReader(path)
+	if err != nil {
+		d.skip(origin, "broken zip file: "+err.Error())
+		return nil
+	}
+	defer zipReader.Close()
+	names := make([]string, 0, len(zipReader.File))
+	innerZips := make([]*zip.File, 0)
+	for _, f := range zipReader.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		// Some feeds put their files in a subdirectory of the zip
+		name := filepath.Base(f.Name)
+		names = append(names, name)
+		if filepath.Ext(name) == ".zip" && !strings.HasPrefix(name, ".") {
+			innerZips = append(innerZips, f)
+		}
+	}
+	missing := missingFeedFiles(names)
+	if len(missing) == 0 {
+		d.addFeed(path, origin)
+		return nil
+	}
+	if len(innerZips) == 0 {
+		d.skip(origin, "missing "+strings.Join(missing, ", "))
+		return nil
+	}
+	for _, f := range innerZips {
+		innerOrigin := origin + "/" + f.Name
+		if depth >= MAX_ARCHIVE_DEPTH {
+			d.skip(innerOrigin, fmt.Sprintf("archives nested deeper than %d", MAX_ARCHIVE_DEPTH))
+			continue
+		}
+		d.Logger.Println("Unpacking", innerOrigin)
+		out, err := os.MkdirTemp(d.Dir, "nested")
+		if err != nil {
+			return err
+		}
+		innerPath := filepath.Join(out, filepath.Base(f.Name))
+		if err := extractZipFile(f, innerPath); err != nil {
+			d.skip(innerOrigin, err.Error())
+			continue
+		}
+		if err := d.addArchive(ctx, innerPath, innerOrigin, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingFeedFiles returns the required GTFS files missing from names
+func missingFeedFiles(names []string) []string {
+	found := make(map[string]bool, len(names))
+	for _, name := range names {
+		found[name] = true
+	}
+	missing := make([]string, 0)
+	for _, f := range gtfs.RequiredFiles {
+		if !found[f] {
+			missing = append(missing, f)
+		}
+	}
+	foundCalendar := false
+	for _, f := range gtfs.RequiredEitherCalendarFiles {
+		foundCalendar = foundCalendar || found[f]
+	}
+	if !foundCalendar {
+		missing = append(missing, strings.Join(gtfs.RequiredEitherCalendarFiles, " or "))
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// matchPatterns returns the first of patterns matching rel. Patterns
+// without a slash match the name as well.
+func matchPatterns(patterns []string, rel string) (string, bool) {
+	name := filepath.Base(rel)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return pattern, true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// isArchivePath tells whether path has the extension of a zip or tar file
+func isArchivePath(path string) bool {
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
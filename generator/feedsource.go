@@ -0,0 +1,282 @@
+package generator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type archiveFormat int
+
+const (
+	ARCHIVE_UNKNOWN archiveFormat = iota
+	ARCHIVE_ZIP
+	ARCHIVE_TAR
+	ARCHIVE_TAR_GZ
+)
+
+// FeedSource provides GTFS feeds. Whatever the source, its feeds end up as
+// local feed directories or zip files that are loaded the same way.
+type FeedSource interface {
+	// Fetch adds the feeds of the source to discovery. Files it needs to
+	// write go below discovery.Dir, which is removed after the network is
+	// built.
+	Fetch(ctx context.Context, discovery *Discovery) error
+	// String names the source in logs and errors
+	String() string
+}
+
+// PathSource is a feed directory, a zip or tar.gz file, or a directory
+// containing them
+type PathSource struct {
+	Path string
+}
+
+func NewPathSource(path string) *PathSource {
+	return &PathSource{Path: path}
+}
+
+func (s *PathSource) Fetch(ctx context.Context, discovery *Discovery) error {
+	// Why do I have to do this
+	path, err := filepath.Abs(s.Path)
+	if err != nil {
+		return err
+	}
+	return discovery.Search(ctx, path)
+}
+
+func (s *PathSource) String() string {
+	return s.Path
+}
+
+// ReaderSource reads a zip, tar or tar.gz file with one or more feeds
+// from Reader. Name is used as file name of the feed, and so as its id.
+type ReaderSource struct {
+	Name   string
+	Reader io.Reader
+}
+
+func NewReaderSource(name string, reader io.Reader) *ReaderSource {
+	return &ReaderSource{Name: name, Reader: reader}
+}
+
+// NewStdinSource reads the feeds from standard input
+func NewStdinSource() *ReaderSource {
+	return NewReaderSource("stdin", os.Stdin)
+}
+
+func (s *ReaderSource) Fetch(ctx context.Context, discovery *Discovery) error {
+	path, err := spoolFeed(ctx, s.Reader, s.Name, discovery.Dir)
+	if err != nil {
+		return err
+	}
+	return discovery.addArchive(ctx, path, s.Name, 0)
+}
+
+func (s *ReaderSource) String() string {
+	return s.Name
+}
+
+// URLSource downloads a zip, tar or tar.gz file with one or more feeds
+type URLSource struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewURLSource(url string) *URLSource {
+	return &URLSource{URL: url, Client: http.DefaultClient}
+}
+
+func (s *URLSource) Fetch(ctx context.Context, discovery *Discovery) error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return errors.New(response.Status)
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		name = u.Host
+	}
+	feedPath, err := spoolFeed(ctx, response.Body, name, discovery.Dir)
+	if err != nil {
+		return err
+	}
+	return discovery.addArchive(ctx, feedPath, s.URL, 0)
+}
+
+func (s *URLSource) String() string {
+	return s.URL
+}
+
+// ParseFeedSource returns the source of a -d argument: "-" is standard
+// input, http and https URLs are downloaded, everything else is a path
+func ParseFeedSource(s string) FeedSource {
+	if s == "-" {
+		return NewStdinSource()
+	}
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return NewURLSource(s)
+	}
+	return NewPathSource(s)
+}
+
+// contextReader stops reading once ctx is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// spoolFeed writes reader to a file called name in a new directory below
+// dir. Zip files get a .zip extension, the GTFS loader needs it.
+func spoolFeed(ctx context.Context, reader io.Reader, name string, dir string) (string, error) {
+	out, err := os.MkdirTemp(dir, "source")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(out, filepath.Base(name))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, contextReader{ctx, reader})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	format, err := sniffArchive(path)
+	if err != nil {
+		return "", err
+	}
+	if format == ARCHIVE_ZIP && filepath.Ext(path) != ".zip" {
+		if err := os.Rename(path, path+".zip"); err != nil {
+			return "", err
+		}
+		path += ".zip"
+	}
+	return path, nil
+}
+
+// sniffArchive tells the archive format of the file at path from its
+// first bytes
+func sniffArchive(path string) (archiveFormat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ARCHIVE_UNKNOWN, err
+	}
+	defer file.Close()
+	header := make([]byte, 262)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ARCHIVE_UNKNOWN, err
+	}
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return ARCHIVE_ZIP, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ARCHIVE_TAR_GZ, nil
+	case n == 262 && string(header[257:262]) == "ustar":
+		return ARCHIVE_TAR, nil
+	}
+	return ARCHIVE_UNKNOWN, nil
+}
+
+func extractZipFile(f *zip.File, path string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return writeFile(path, rc)
+}
+
+// extractTar writes the regular files of the tar file at path to dir,
+// entries leading outside of dir are skipped and logged to logger
+func extractTar(path string, format archiveFormat, dir string, logger *log.Logger) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if format == ARCHIVE_TAR_GZ {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			logger.Println("Skipping", header.Name, "outside of", path)
+			continue
+		}
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(target, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, reader io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
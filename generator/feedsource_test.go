@@ -0,0 +1,246 @@
+package generator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testFeedZip returns a zip file with the required GTFS files in a
+// subdirectory, as some feeds have them
+func testFeedZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"agency.txt", "stops.txt", "routes.txt", "trips.txt", "stop_times.txt", "calendar.txt"} {
+		f, err := w.Create("feed/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte("x\n"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testZip returns a zip file with the given files
+func testZip(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range sortedNames(files) {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(files[name])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testTarGz returns a tar.gz file with the given files, names are written
+// as they are
+func testTarGz(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedNames(files) {
+		content := files[name]
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(content)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func fetchFeeds(t *testing.T, source FeedSource) (*Discovery, error) {
+	discovery := NewDiscovery(nil, nil, t.TempDir())
+	err := source.Fetch(context.Background(), discovery)
+	return discovery, err
+}
+
+func feedIdList(discovery *Discovery) []string {
+	ids := make([]string, 0, len(discovery.Feeds))
+	for _, path := range discovery.Feeds {
+		ids = append(ids, discovery.FeedIds().Id(path))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestURLSource(t *testing.T) {
+	feedZip := testFeedZip(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(feedZip)
+	}))
+	defer server.Close()
+
+	discovery, err := fetchFeeds(t, ParseFeedSource(server.URL+"/gtfs/berlin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discovery.Feeds) != 1 {
+		t.Fatalf("got feeds %v, want one", discovery.Feeds)
+	}
+	// Zip files without extension get one for the GTFS loader
+	if filepath.Base(discovery.Feeds[0]) != "berlin.zip" {
+		t.Errorf("got feed file %s, want berlin.zip", discovery.Feeds[0])
+	}
+	if id := discovery.FeedIds().Id(discovery.Feeds[0]); id != server.URL+"/gtfs/berlin" {
+		t.Errorf("got feed id %s, want the URL", id)
+	}
+
+	_, err = fetchFeeds(t, ParseFeedSource(server.URL+"/missing"))
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got error %v, want 404", err)
+	}
+}
+
+func TestTarGzSkipsEntriesOutside(t *testing.T) {
+	feedZip := testFeedZip(t)
+	tarGz := testTarGz(t, map[string][]byte{
+		"a/b.zip":              feedZip,
+		"../evil.txt":          []byte("x"),
+		"a/../../evil.txt":     []byte("x"),
+		"/tmp/abs/evil.txt":    []byte("x"),
+		"c/agency.txt":         nil,
+		"c/stops.txt":          nil,
+		"c/routes.txt":         nil,
+		"c/trips.txt":          nil,
+		"c/stop_times.txt":     nil,
+		"c/calendar_dates.txt": nil,
+	})
+	dir := t.TempDir()
+	discovery := NewDiscovery(nil, nil, filepath.Join(dir, "work"))
+	if err := os.Mkdir(discovery.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := NewReaderSource("feeds.tar.gz", bytes.NewReader(tarGz)).Fetch(context.Background(), discovery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"feeds.tar.gz/a/b.zip", "feeds.tar.gz/c"}
+	if got := feedIdList(discovery); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got feeds %v, want %v", got, want)
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Name() == "evil.txt" {
+			t.Errorf("entry outside of the archive written to %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNestedZip(t *testing.T) {
+	feedZip := testFeedZip(t)
+	bundle := testZip(t, map[string][]byte{
+		"dl/agencya.zip": feedZip,
+		"dl/agencyb.zip": testZip(t, map[string][]byte{"inner/agencyc.zip": feedZip}),
+		"README.txt":     []byte("feeds"),
+	})
+	discovery, err := fetchFeeds(t, NewReaderSource("bundle", bytes.NewReader(bundle)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"bundle/dl/agencya.zip", "bundle/dl/agencyb.zip/inner/agencyc.zip"}
+	if got := feedIdList(discovery); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got feeds %v, want %v", got, want)
+	}
+
+	// Too deeply nested archives are skipped
+	deep := feedZip
+	for i := 0; i <= MAX_ARCHIVE_DEPTH+1; i++ {
+		deep = testZip(t, map[string][]byte{"dl/feed.zip": deep})
+	}
+	discovery, err = fetchFeeds(t, NewReaderSource("deep", bytes.NewReader(deep)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discovery.Feeds) != 0 || len(discovery.Skipped) != 1 {
+		t.Errorf("got feeds %v and skipped %v, want one skipped", discovery.Feeds, discovery.Skipped)
+	}
+}
+
+func TestFeedIdsStable(t *testing.T) {
+	src := t.TempDir()
+	tarGz := testTarGz(t, map[string][]byte{"a/b.zip": testFeedZip(t), "c/d.zip": testFeedZip(t)})
+	if err := os.WriteFile(filepath.Join(src, "feeds.tgz"), tarGz, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "plain.zip"), testFeedZip(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Feeds are unpacked to a different directory every time, their ids
+	// stay the same
+	want := []string{"feeds.tgz/a/b.zip", "feeds.tgz/c/d.zip"}
+	for i := 0; i < 2; i++ {
+		discovery, err := fetchFeeds(t, NewPathSource(filepath.Join(src, "feeds.tgz")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := feedIdList(discovery); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got feed ids %v, want %v", got, want)
+		}
+	}
+
+	// Searching a directory makes ids relative to its parent
+	discovery, err := fetchFeeds(t, NewPathSource(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Base(src)
+	want = []string{base + "/feeds.tgz/a/b.zip", base + "/feeds.tgz/c/d.zip", base + "/plain.zip"}
+	if got := feedIdList(discovery); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got feed ids %v, want %v", got, want)
+	}
+
+	// Sources with the same name get unique ids
+	discovery = NewDiscovery(nil, nil, t.TempDir())
+	for i := 0; i < 2; i++ {
+		err := NewReaderSource("gtfs.zip", bytes.NewReader(testFeedZip(t))).Fetch(context.Background(), discovery)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want = []string{"gtfs.zip", "gtfs.zip#2"}
+	if got := feedIdList(discovery); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got feed ids %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// FrequencyExactTimes records which frequencies.txt rows have
+// exact_times=1, keyed by trip id and start time
+type FrequencyExactTimes map[string]bool
+
+func frequencyKey(tripId string, startTime uint) string {
+	return tripId + "|" + strconv.FormatUint(uint64(startTime), 10)
+}
+
+func (e FrequencyExactTimes) IsExact(tripId string, startTime uint) bool {
+	return e[frequencyKey(tripId, startTime)]
+}
+
+// readFrequencyExactTimes reads exact_times from frequencies.txt of the
+// feed at path
+func readFrequencyExactTimes(path string) (FrequencyExactTimes, error) {
+	exactTimes := make(FrequencyExactTimes)
+	_, err := readGtfsCsv(path, "frequencies.txt", func(row map[string]string) error {
+		if row["exact_times"] != "1" {
+			return nil
+		}
+		startTime, err := parseGtfsTime(row["start_time"])
+		if err != nil {
+			return fmt.Errorf("invalid start_time for trip %s: %v", row["trip_id"], err)
+		}
+		exactTimes[frequencyKey(row["trip_id"], startTime)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exactTimes, nil
+}
+
+// parseGtfsTime parses HH:MM:SS into seconds after midnight, hours may
+// be 24 or more for trips after midnight
+func parseGtfsTime(s string) (uint, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("time %q not in HH:MM:SS", s)
+	}
+	var seconds uint
+	for _, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("time %q not in HH:MM:SS", s)
+		}
+		seconds = seconds*60 + uint(v)
+	}
+	return seconds, nil
+}
+
+// GetTripDepartures returns the departure times at the first stop of
+// trip within window. Rows of frequencies.txt with exact_times=1 depart
+// exactly every headway from their start time. For other rows only the
+// headway is known, so their overlap with the window is filled with
+// evenly spaced departures, one per headway.
+func GetTripDepartures(trip *gtfs.Trip, window ServiceWindow, exactTimes FrequencyExactTimes) []int {
+	if len(trip.Frequencies) == 0 {
+		if len(trip.StopTimes) == 0 {
+			return nil
+		}
+		depTime := trip.StopTimes[0].DepartureTime
+		depHour := int32(depTime / (60 * 60))
+		// If departure time of is within service hour range
+		if !window.ContainsHour(depHour) {
+			return nil
+		}
+		return []int{int(depTime)}
+	}
+
+	depTimes := make([]int, 0)
+	windowStart := int(window.Start) * 60 * 60
+	windowEnd := int(window.End()) * 60 * 60
+	for _, freq := range trip.Frequencies {
+		headway := int(freq.HeadwaySecs)
+		if headway <= 0 {
+			continue
+		}
+		startTime := int(freq.StartTime)
+		endTime := int(freq.EndTime)
+		if exactTimes.IsExact(trip.Id, uint(freq.StartTime)) {
+			for depTime := startTime; depTime < endTime; depTime += headway {
+				if depTime >= windowStart && depTime < windowEnd {
+					depTimes = append(depTimes, depTime)
+				}
+			}
+			continue
+		}
+		if startTime < windowStart {
+			startTime = windowStart
+		}
+		if endTime > windowEnd {
+			endTime = windowEnd
+		}
+		overlap := endTime - startTime
+		if overlap <= 0 {
+			continue
+		}
+		count := round(float64(overlap) / float64(headway))
+		for i := 0; i < count; i++ {
+			depTimes = append(depTimes, startTime+round((float64(i)+0.5)*float64(overlap)/float64(count)))
+		}
+	}
+	return depTimes
+}
+
+// GetAllTripDepartures returns all departure times at the first stop of
+// trip, frequencies.txt rows without exact_times are filled over their
+// whole time span
+func GetAllTripDepartures(trip *gtfs.Trip, exactTimes FrequencyExactTimes) []int {
+	return GetTripDepartures(trip, ServiceWindow{Start: 0, Duration: math.MaxInt16}, exactTimes)
+}
@@ -0,0 +1,114 @@
+// Package generator builds Mapnificent networks from GTFS feeds.
+//
+//	g, err := generator.New(generator.Options{WalkRadius: 500})
+//	sources := []generator.FeedSource{generator.NewPathSource("/data/berlin.zip")}
+//	network, report, err := g.Build(ctx, sources)
+//
+// Nothing is logged unless Options.Logger is set. The mapnificent_generator
+// command is a thin wrapper around it.
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+// NetworkReport counts what GetNetwork did to the network
+type NetworkReport struct {
+	Stops int
+	Lines int
+	// Stops whose walks were looked up and the time spent on it
+	WalkLookups    int
+	WalkLookupTime time.Duration
+	// Walks not connected by the street network
+	DroppedWalks int
+	PrunedWalks  WalkPruning
+	// Walks added in the opposite direction
+	ReverseWalks int
+	// Stops without travel options
+	DeadEnds int
+	// Dead ends removed if RemoveDeadEnds is set
+	RemovedDeadEnds int
+}
+
+// Report describes a build: the feeds found and skipped, how loading them
+// went and what was done to the network
+type Report struct {
+	Feeds   []string
+	Skipped []SkippedPath
+	Load    *LoadSummary
+	NetworkReport
+}
+
+// Generator builds networks with fixed options, it can be used for
+// several builds
+type Generator struct {
+	options Options
+}
+
+// New checks the options and fills in their defaults
+func New(options Options) (*Generator, error) {
+	if err := options.Prepare(); err != nil {
+		return nil, err
+	}
+	return &Generator{options: options}, nil
+}
+
+// Options returns the options of the generator with defaults filled in
+func (g *Generator) Options() Options {
+	return g.options
+}
+
+// Discover fetches the feeds of sources. Files written by the sources go
+// below dir.
+func (g *Generator) Discover(ctx context.Context, sources []FeedSource, dir string) (*Discovery, error) {
+	discovery := NewDiscovery(g.options.Include, g.options.Exclude, dir)
+	discovery.Logger = g.options.Logger
+	for _, source := range sources {
+		g.options.Logger.Println("Fetching", source)
+		if err := source.Fetch(ctx, discovery); err != nil {
+			return discovery, fmt.Errorf("%s: %v", source, err)
+		}
+	}
+	return discovery, nil
+}
+
+// Build fetches the GTFS feeds of sources, loads them and builds their
+// network. Files written by the sources are removed when Build returns.
+// The report is filled as far as the build got, also when an error is
+// returned.
+func (g *Generator) Build(ctx context.Context, sources []FeedSource) (*mapnificent.MapnificentNetwork, Report, error) {
+	var report Report
+	dir, err := os.MkdirTemp("", "mapnificent_generator")
+	if err != nil {
+		return nil, report, err
+	}
+	defer os.RemoveAll(dir)
+	discovery, err := g.Discover(ctx, sources, dir)
+	report.Feeds, report.Skipped = discovery.Feeds, discovery.Skipped
+	if err != nil {
+		return nil, report, err
+	}
+	if len(report.Feeds) == 0 {
+		return nil, report, errors.New("no GTFS feeds found")
+	}
+
+	options := g.options
+	feeds, streams, summary, err := LoadFeeds(ctx, report.Feeds, options.LoadWorkers, options.LoadPolicy, options.Streaming, options.Logger)
+	report.Load = summary
+	if err != nil {
+		return nil, report, err
+	}
+
+	network, networkReport, err := GetNetwork(ctx, feeds, discovery.FeedIds(), streams, &options)
+	if err != nil {
+		return nil, report, err
+	}
+	report.NetworkReport = *networkReport
+	return network, report, nil
+}
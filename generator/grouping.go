@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"container/list"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// LineGrouping selects how trips are grouped into lines
+type LineGrouping string
+
+const (
+	// Group by route and headsign/direction, see GetTripHash
+	GROUP_HEADSIGN LineGrouping = "headsign"
+	// Group by route and exact ordered stop sequence
+	GROUP_PATTERN LineGrouping = "pattern"
+	// Like GROUP_PATTERN, but patterns that are a contiguous part of
+	// exactly one longer pattern of the same route (short-turns) are
+	// merged into it
+	GROUP_SUBPATTERN LineGrouping = "subpattern"
+)
+
+// GetLineHash returns the key of the line group trip belongs to, empty
+// for trips without a route, which belong to no line
+func GetLineHash(trip *gtfs.Trip, grouping LineGrouping) string {
+	if grouping == GROUP_PATTERN || grouping == GROUP_SUBPATTERN {
+		return GetPatternHash(trip)
+	}
+	return GetTripHash(trip)
+}
+
+// GetPatternHash gets a hash based on route and the ordered stops of trip,
+// empty if trip has no route
+func GetPatternHash(trip *gtfs.Trip) string {
+	if trip.Route == nil {
+		return ""
+	}
+	h := md5.New()
+	io.WriteString(h, trip.Route.Id)
+	io.WriteString(h, "||")
+	for _, stoptime := range trip.StopTimes {
+		io.WriteString(h, stoptime.Stop.Id)
+		io.WriteString(h, "||")
+	}
+	return hex.EncodeToString(h.Sum(nil)[:])
+}
+
+// patternString joins the stop ids of trip so that a contiguous part of
+// the stop sequence is a substring
+func patternString(trip *gtfs.Trip) string {
+	var b strings.Builder
+	b.WriteString("\x00")
+	for _, stoptime := range trip.StopTimes {
+		b.WriteString(stoptime.Stop.Id)
+		b.WriteString("\x00")
+	}
+	return b.String()
+}
+
+// MergeSubPatterns merges line groups of exact stop patterns into the
+// group of a longer pattern of the same route if their stops are a
+// contiguous part of it. Patterns fitting into several longer patterns
+// (e.g. the common trunk of two branches) are kept separate. The trips
+// of the longer pattern stay in front of the list.
+func MergeSubPatterns(lineMap map[string]*list.List) {
+	type pattern struct {
+		hash  string
+		stops string
+		trips *list.List
+	}
+	routePatterns := make(map[string][]*pattern)
+	for hash, trips := range lineMap {
+		trip := trips.Front().Value.(*gtfs.Trip)
+		routePatterns[trip.Route.Id] = append(routePatterns[trip.Route.Id], &pattern{hash, patternString(trip), trips})
+	}
+
+	for _, patterns := range routePatterns {
+		// Longest patterns first
+		sort.Slice(patterns, func(i, j int) bool {
+			if len(patterns[i].stops) != len(patterns[j].stops) {
+				return len(patterns[i].stops) > len(patterns[j].stops)
+			}
+			return patterns[i].hash < patterns[j].hash
+		})
+		parents := make([]*pattern, 0, len(patterns))
+		for _, p := range patterns {
+			var parent *pattern
+			matches := 0
+			for _, candidate := range parents {
+				if strings.Contains(candidate.stops, p.stops) {
+					parent = candidate
+					matches += 1
+				}
+			}
+			if matches != 1 {
+				parents = append(parents, p)
+				continue
+			}
+			parent.trips.PushBackList(p.trips)
+			delete(lineMap, p.hash)
+		}
+	}
+}
+
+// GetStopPatterns returns one trip for every distinct stop sequence in
+// trips, in order of first appearance
+func GetStopPatterns(trips *list.List) []*gtfs.Trip {
+	patterns := make([]*gtfs.Trip, 0, 1)
+	seen := make(map[string]bool)
+	for trip := trips.Front(); trip != nil; trip = trip.Next() {
+		realTrip := trip.Value.(*gtfs.Trip)
+		stops := patternString(realTrip)
+		if seen[stops] {
+			continue
+		}
+		seen[stops] = true
+		patterns = append(patterns, realTrip)
+	}
+	return patterns
+}
@@ -0,0 +1,29 @@
+package generator
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+func TestLineHashWithoutRoute(t *testing.T) {
+	stop := &gtfs.Stop{Id: "A"}
+	trip := &gtfs.Trip{Id: "t", StopTimes: []gtfs.StopTime{{Stop: stop}}}
+	for _, grouping := range []LineGrouping{GROUP_HEADSIGN, GROUP_PATTERN, GROUP_SUBPATTERN} {
+		if hash := GetLineHash(trip, grouping); hash != "" {
+			t.Errorf("%s: got hash %q for a trip without route, want none", grouping, hash)
+		}
+	}
+	trip.Route = &gtfs.Route{Id: "R", ShortName: "1"}
+	if GetLineHash(trip, GROUP_HEADSIGN) == "" || GetLineHash(trip, GROUP_PATTERN) == "" {
+		t.Error("expected a hash for a trip with route")
+	}
+
+	trips := list.New()
+	trips.PushBack(&gtfs.Trip{Id: "u"})
+	trips.PushBack(trip)
+	if name := GetRouteNamesFromTrips(trips); name != "1 (R)" {
+		t.Errorf("got route names %q, want 1 (R)", name)
+	}
+}
@@ -0,0 +1,101 @@
+package generator
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// openGtfsFile opens the GTFS file name in the feed at path, which is
+// either a directory or a zip file. It returns os.ErrNotExist if the
+// feed does not contain the file.
+func openGtfsFile(path string, name string) (io.ReadCloser, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fileInfo.IsDir() {
+		return os.Open(filepath.Join(path, name))
+	}
+	zipReader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zipReader.File {
+		// Some feeds put their files in a subdirectory of the zip
+		if filepath.Base(f.Name) != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			zipReader.Close()
+			return nil, err
+		}
+		return &zipFileReader{rc, zipReader}, nil
+	}
+	zipReader.Close()
+	return nil, os.ErrNotExist
+}
+
+type zipFileReader struct {
+	io.ReadCloser
+	zipReader *zip.ReadCloser
+}
+
+func (z *zipFileReader) Close() error {
+	z.ReadCloser.Close()
+	return z.zipReader.Close()
+}
+
+// readGtfsCsv calls fn with every row of the GTFS file name in the feed
+// at path, keyed by column name. A missing file is not an error,
+// found reports whether the file exists.
+func readGtfsCsv(path string, name string, fn func(row map[string]string) error) (found bool, err error) {
+	file, err := openGtfsFile(path, name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return true, nil
+	}
+	if err != nil {
+		return true, fmt.Errorf("%s in %s: %v", name, path, err)
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+	}
+	row := make(map[string]string, len(header))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return true, fmt.Errorf("%s in %s: %v", name, path, err)
+		}
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = strings.TrimSpace(record[i])
+			} else {
+				row[column] = ""
+			}
+		}
+		if err := fn(row); err != nil {
+			return true, fmt.Errorf("%s in %s: %v", name, path, err)
+		}
+	}
+	return true, nil
+}
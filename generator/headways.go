@@ -0,0 +1,138 @@
+package generator
+
+import (
+	"container/list"
+	"sort"
+
+	"github.com/mapnificent/gogtfs"
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+type IntervalMetric string
+
+const (
+	// Average gap between departures
+	INTERVAL_MEAN IntervalMetric = "mean"
+	// Twice the expected waiting time of a passenger arriving at a random
+	// time, equals the mean for regular departures but grows with
+	// irregular gaps
+	INTERVAL_WAIT IntervalMetric = "wait"
+	// Longest gap between departures
+	INTERVAL_MAX IntervalMetric = "max"
+)
+
+// HeadwayStats describes the departures of a line in a service window
+type HeadwayStats struct {
+	Trips int
+	// Average gap between departures in seconds
+	Mean float64
+	// Expected waiting time in seconds: sum of squared gaps over twice
+	// the sum of gaps
+	ExpectedWait float64
+	// Longest gap between departures in seconds
+	MaxGap int
+}
+
+// Interval returns the headway in seconds according to metric
+func (s HeadwayStats) Interval(metric IntervalMetric) int {
+	switch metric {
+	case INTERVAL_WAIT:
+		return round(2 * s.ExpectedWait)
+	case INTERVAL_MAX:
+		return s.MaxGap
+	}
+	return round(s.Mean)
+}
+
+// GetHeadwayStats computes headway statistics from departure times,
+// ok is false if there are less than two departures
+func GetHeadwayStats(depTimes []int) (stats HeadwayStats, ok bool) {
+	stats.Trips = len(depTimes)
+	if len(depTimes) < 2 {
+		// only once in the window? no pattern
+		return stats, false
+	}
+	sort.Ints(depTimes)
+
+	gapSum := 0.0
+	squaredGapSum := 0.0
+	for i := 1; i < len(depTimes); i++ {
+		gap := depTimes[i] - depTimes[i-1]
+		gapSum += float64(gap)
+		squaredGapSum += float64(gap) * float64(gap)
+		if gap > stats.MaxGap {
+			stats.MaxGap = gap
+		}
+	}
+	stats.Mean = gapSum / float64(len(depTimes)-1)
+	if gapSum > 0 {
+		stats.ExpectedWait = squaredGapSum / (2 * gapSum)
+	}
+	return stats, true
+}
+
+func windowFromLineTime(lineTime *mapnificent.MapnificentNetwork_Line_LineTime) ServiceWindow {
+	return ServiceWindow{
+		Weekdays: int32(lineTime.Weekday),
+		Start:    int32(lineTime.Start),
+		Duration: int32(lineTime.Stop - lineTime.Start),
+	}
+}
+
+// GetStopDepartures collects the departure times at every stop of line
+// for each of its LineTimes, serviceTrips as returned by GetFrequencies.
+// A departure counts for a window if it leaves that stop within the
+// window, so trips starting before the window count at the stops they
+// reach within it.
+func GetStopDepartures(line *mapnificent.MapnificentNetwork_Line, serviceTrips []*list.List, exactTimes FrequencyExactTimes) []map[string][]int {
+	stopDepartures := make([]map[string][]int, len(serviceTrips))
+	for i, tripList := range serviceTrips {
+		window := windowFromLineTime(line.LineTimes[i])
+		departures := make(map[string][]int)
+		for trip := tripList.Front(); trip != nil; trip = trip.Next() {
+			realTrip := trip.Value.(*gtfs.Trip)
+			if len(realTrip.StopTimes) == 0 {
+				continue
+			}
+			// Stop times of frequency based trips are relative to the
+			// departure at the first stop
+			firstDeparture := int(realTrip.StopTimes[0].DepartureTime)
+			for _, depTime := range GetAllTripDepartures(realTrip, exactTimes) {
+				for _, stoptime := range realTrip.StopTimes {
+					stopDeparture := depTime + int(stoptime.DepartureTime) - firstDeparture
+					if !window.ContainsHour(int32(stopDeparture / (60 * 60))) {
+						continue
+					}
+					departures[stoptime.Stop.Id] = append(departures[stoptime.Stop.Id], stopDeparture)
+				}
+			}
+		}
+		stopDepartures[i] = departures
+	}
+	return stopDepartures
+}
+
+// GetStopIntervals returns the interval of line at stopId for every
+// LineTime of line, 0 where there is no regular service at the stop.
+// It returns nil if the intervals are the same as the line's.
+func GetStopIntervals(line *mapnificent.MapnificentNetwork_Line, stopDepartures []map[string][]int, stopId string, metric IntervalMetric) []uint32 {
+	intervals := make([]uint32, len(line.LineTimes))
+	differs := false
+	for i, lineTime := range line.LineTimes {
+		if i >= len(stopDepartures) {
+			intervals[i] = lineTime.Interval
+			continue
+		}
+		stats, ok := GetHeadwayStats(stopDepartures[i][stopId])
+		if ok && stats.Interval(metric) > 0 {
+			intervals[i] = uint32(stats.Interval(metric))
+		}
+		if intervals[i] != lineTime.Interval {
+			differs = true
+		}
+	}
+	if !differs {
+		return nil
+	}
+	return intervals
+}
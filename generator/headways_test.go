@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+
+	"github.com/mapnificent/gogtfs"
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+func TestStopDeparturesWindowEdge(t *testing.T) {
+	// A long line from A to D every 15 minutes taking 80 minutes. Trips
+	// leaving A before 7 reach D within the window, trips leaving A
+	// after 8 reach D after it.
+	stops := make([]*gtfs.Stop, 0)
+	for _, id := range []string{"A", "B", "C", "D"} {
+		stops = append(stops, &gtfs.Stop{Id: id})
+	}
+	trips := list.New()
+	for k := 0; k < 16; k++ {
+		departure := uint(5*3600 + k*15*60)
+		trip := &gtfs.Trip{Id: fmt.Sprint("t", k), ServiceId: "S"}
+		for j, stop := range stops {
+			stopTime := departure + uint(j*80*60/3)
+			trip.StopTimes = append(trip.StopTimes, gtfs.StopTime{Stop: stop, ArrivalTime: stopTime, DepartureTime: stopTime})
+		}
+		trips.PushBack(trip)
+	}
+	feed := &gtfs.Feed{Calendars: map[string]*gtfs.Calendar{"S": {ServiceId: "S", Monday: true}}, CalendarDates: map[string][]*gtfs.CalendarDate{}}
+	calendar, err := NewServiceCalendar("", feed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := &mapnificent.MapnificentNetwork_Line{}
+	window := ServiceWindow{Weekdays: 1, Start: 7, Duration: 1}
+	_, serviceTrips := GetFrequencies(feed, calendar, FrequencyExactTimes{}, trips, line, []ServiceWindow{window}, INTERVAL_MEAN)
+	if len(line.LineTimes) != 1 {
+		t.Fatalf("got %d line times, want 1", len(line.LineTimes))
+	}
+
+	departures := GetStopDepartures(line, serviceTrips, FrequencyExactTimes{})[0]
+	for _, stop := range stops {
+		times := departures[stop.Id]
+		// Four departures from 7:00 to 7:59 at every stop
+		if len(times) != 4 {
+			t.Errorf("stop %s: got departures %v, want 4", stop.Id, times)
+			continue
+		}
+		for _, depTime := range times {
+			if depTime < 7*3600 || depTime >= 8*3600 {
+				t.Errorf("stop %s: departure %s outside of the window", stop.Id, formatGtfsTime(uint(depTime)))
+			}
+		}
+	}
+}
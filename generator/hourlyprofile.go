@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"container/list"
+
+	"github.com/mapnificent/gogtfs"
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+const (
+	HOURS_PER_DAY  = 24
+	HOURS_PER_WEEK = 7 * HOURS_PER_DAY
+)
+
+// addHourlyDepartures counts a departure given in seconds after midnight
+// of the service day in the hour slots of every weekday of the service.
+// Departures after midnight are counted on the following day.
+func addHourlyDepartures(departures []uint, weekdays int32, depTime uint) {
+	dayOffset := int(depTime / (60 * 60 * HOURS_PER_DAY))
+	hour := int(depTime/(60*60)) % HOURS_PER_DAY
+	for day := 0; day < 7; day++ {
+		if weekdays&(1<<uint(day)) == 0 {
+			continue
+		}
+		slot := ((day+dayOffset)%7)*HOURS_PER_DAY + hour
+		departures[slot] += 1
+	}
+}
+
+// GetHourlyProfile computes the interval of a line for every hour of the
+// week from stop_times and frequencies.txt and stores it run-length
+// encoded in HourlyIntervals. The calendar needs dates, a trip is counted
+// on the weekday of every date it runs on, so each weekday is counted
+// for one concrete date.
+func GetHourlyProfile(calendar *ServiceCalendar, trips *list.List, line *mapnificent.MapnificentNetwork_Line) {
+	departures := make([]uint, HOURS_PER_WEEK)
+
+	for trip := trips.Front(); trip != nil; trip = trip.Next() {
+		realTrip := trip.Value.(*gtfs.Trip)
+		weekdays := calendar.Weekdays(realTrip.ServiceId)
+		if weekdays == 0 {
+			continue
+		}
+
+		if len(realTrip.Frequencies) > 0 {
+			// Expand frequencies into single departures
+			for _, freq := range realTrip.Frequencies {
+				if freq.HeadwaySecs == 0 {
+					continue
+				}
+				for depTime := uint(freq.StartTime); depTime < uint(freq.EndTime); depTime += uint(freq.HeadwaySecs) {
+					addHourlyDepartures(departures, weekdays, depTime)
+				}
+			}
+			continue
+		}
+
+		if len(realTrip.StopTimes) == 0 {
+			continue
+		}
+		addHourlyDepartures(departures, weekdays, uint(realTrip.StopTimes[0].DepartureTime))
+	}
+
+	intervals := make([]uint32, HOURS_PER_WEEK)
+	hasService := false
+	for slot, count := range departures {
+		if count == 0 {
+			continue
+		}
+		intervals[slot] = uint32(round(60 * 60 / float64(count)))
+		hasService = true
+	}
+	if !hasService {
+		return
+	}
+	line.HourlyIntervals = encodeHourlyIntervals(intervals)
+}
+
+// encodeHourlyIntervals run-length encodes intervals as pairs of
+// (number of hours, interval)
+func encodeHourlyIntervals(intervals []uint32) []uint32 {
+	encoded := make([]uint32, 0)
+	for i := 0; i < len(intervals); {
+		j := i + 1
+		for j < len(intervals) && intervals[j] == intervals[i] {
+			j += 1
+		}
+		encoded = append(encoded, uint32(j-i), intervals[i])
+		i = j
+	}
+	return encoded
+}
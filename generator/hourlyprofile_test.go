@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// decodeHourlyIntervals expands run-length encoded HourlyIntervals
+func decodeHourlyIntervals(encoded []uint32) []uint32 {
+	intervals := make([]uint32, 0, HOURS_PER_WEEK)
+	for i := 0; i+1 < len(encoded); i += 2 {
+		for j := uint32(0); j < encoded[i]; j++ {
+			intervals = append(intervals, encoded[i+1])
+		}
+	}
+	return intervals
+}
+
+func TestHourlyProfileRepresentativeWeek(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "calendar.txt", "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\nS,1,1,1,1,1,1,1,20260105,20260628\n")
+	// X only runs on a single Wednesday
+	writeTestFile(t, dir, "calendar_dates.txt", "service_id,date,exception_type\nX,20260304,1\n")
+	writeTestFile(t, dir, "stops.txt", "stop_id,stop_name,stop_lat,stop_lon\nA,A,52.0,13.0\nB,B,52.01,13.0\n")
+	writeTestFile(t, dir, "routes.txt", "route_id,route_short_name\nR,1\n")
+	writeTestFile(t, dir, "trips.txt", "route_id,service_id,trip_id\nR,S,t1\nR,S,t2\nR,X,t3\n")
+	writeTestFile(t, dir, "stop_times.txt", "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n"+
+		"t1,07:00:00,07:00:00,A,1\nt1,07:05:00,07:05:00,B,2\n"+
+		"t2,07:30:00,07:30:00,A,1\nt2,07:35:00,07:35:00,B,2\n"+
+		"t3,07:15:00,07:15:00,A,1\nt3,07:20:00,07:20:00,B,2\n")
+	feed, streamed, err := LoadStreamedFeed(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feeds := map[string]*gtfs.Feed{dir: feed}
+	streams := StopTimeStreams{dir: streamed}
+
+	var logged bytes.Buffer
+	options := &Options{HourlyProfile: true, Logger: log.New(&logged, "", 0)}
+	if err := options.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	network, _, err := GetNetwork(context.Background(), feeds, nil, streams, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged.String(), "Representative week starts") {
+		t.Errorf("expected the representative week to be logged, got %q", logged.String())
+	}
+	if len(network.Lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(network.Lines))
+	}
+	intervals := decodeHourlyIntervals(network.Lines[0].HourlyIntervals)
+	if len(intervals) != HOURS_PER_WEEK {
+		t.Fatalf("got %d hours, want %d", len(intervals), HOURS_PER_WEEK)
+	}
+	// Every day two departures at 7, the single date of X is not part of
+	// the representative week
+	for day := 0; day < 7; day++ {
+		if got := intervals[day*HOURS_PER_DAY+7]; got != 1800 {
+			t.Errorf("day %d: got interval %d at 7, want 1800", day, got)
+		}
+	}
+
+	// Without any service in the calendar files there is no week to count
+	writeTestFile(t, dir, "calendar.txt", "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n")
+	writeTestFile(t, dir, "calendar_dates.txt", "service_id,date,exception_type\n")
+	feed, streamed, err = LoadStreamedFeed(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feeds, streams = map[string]*gtfs.Feed{dir: feed}, StopTimeStreams{dir: streamed}
+	_, _, err = GetNetwork(context.Background(), feeds, nil, streams, options)
+	if err == nil || !strings.Contains(err.Error(), "hourly profile") {
+		t.Errorf("got error %v, want an hourly profile error", err)
+	}
+}
@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+type LoadPolicy string
+
+const (
+	// Stop loading at the first feed that fails
+	LOAD_FAIL_FAST LoadPolicy = "fail-fast"
+	// Skip feeds that fail and go on with the others
+	LOAD_SKIP_BAD LoadPolicy = "skip"
+)
+
+// FeedLoadResult is the outcome of loading one feed
+type FeedLoadResult struct {
+	Path      string
+	Feed      *gtfs.Feed
+	Stream    *StreamedStopTimes
+	Err       error
+	Duration  time.Duration
+	StopTimes int
+}
+
+// LoadSummary lists the results of all feeds sorted by path, feeds that
+// were not started because of an earlier failure are missing
+type LoadSummary struct {
+	Results []FeedLoadResult
+}
+
+// Failed returns the results of the feeds that could not be loaded
+func (s *LoadSummary) Failed() []FeedLoadResult {
+	failed := make([]FeedLoadResult, 0)
+	for _, result := range s.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Log writes which feeds loaded and why the others failed to logger
+func (s *LoadSummary) Log(logger *log.Logger) {
+	totalStopTimes := 0
+	for _, result := range s.Results {
+		if result.Err != nil {
+			logger.Println("Failed", result.Path, "after", result.Duration, result.Err)
+			continue
+		}
+		logger.Println("Loaded", result.Path, "with", result.StopTimes, "stop times in", result.Duration)
+		totalStopTimes += result.StopTimes
+	}
+	logger.Println("Loaded", len(s.Results)-len(s.Failed()), "of", len(s.Results), "feeds with", totalStopTimes, "stop times")
+}
+
+// loadFeed loads the feed at path, a panic while parsing becomes an error
+func loadFeed(path string) (feed *gtfs.Feed, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			feed, err = nil, fmt.Errorf("%s: %v", path, r)
+		}
+	}()
+	feed, err = gtfs.NewFeed(path)
+	if err != nil {
+		return nil, err
+	}
+	feed.RoutingOnly = true
+	feed.Load()
+	return feed, nil
+}
+
+// loadStreamedFeed is LoadStreamedFeed with panics turned into errors
+func loadStreamedFeed(path string) (feed *gtfs.Feed, streamed *StreamedStopTimes, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			feed, streamed, err = nil, nil, fmt.Errorf("%s: %v", path, r)
+		}
+	}()
+	return LoadStreamedFeed(path)
+}
+
+// LoadFeeds loads the feeds at paths with at most workers feeds at a time,
+// in streaming mode their stop times are returned as streams. With
+// LOAD_FAIL_FAST no further feeds are started after the first failure and
+// its error is returned, with LOAD_SKIP_BAD failed feeds are left out and
+// an error is only returned if no feed loaded. Once ctx is done no further
+// feeds are started and the context error is returned. Progress goes to
+// logger.
+func LoadFeeds(ctx context.Context, paths []string, workers int, policy LoadPolicy, streaming bool, logger *log.Logger) (map[string]*gtfs.Feed, StopTimeStreams, *LoadSummary, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan string)
+	results := make(chan FeedLoadResult)
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				logger.Println("Started loading", path)
+				start := time.Now()
+				var result FeedLoadResult
+				if streaming {
+					result.Feed, result.Stream, result.Err = loadStreamedFeed(path)
+				} else {
+					result.Feed, result.Err = loadFeed(path)
+				}
+				result.Path, result.Duration = path, time.Since(start)
+				feed := result.Feed
+				if feed != nil {
+					result.StopTimes = feed.StopTimesCount
+				}
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, path := range paths {
+			select {
+			case jobs <- path:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results are only collected here, so the feeds map needs no lock
+	feeds := make(map[string]*gtfs.Feed, len(paths))
+	streams := make(StopTimeStreams)
+	summary := new(LoadSummary)
+	var firstErr error
+	for result := range results {
+		summary.Results = append(summary.Results, result)
+		if result.Err == nil {
+			feeds[result.Path] = result.Feed
+			if result.Stream != nil {
+				streams[result.Path] = result.Stream
+			}
+			continue
+		}
+		if firstErr == nil {
+			firstErr = result.Err
+			if policy == LOAD_FAIL_FAST {
+				// Feeds already loading still finish
+				close(stop)
+			}
+		}
+	}
+	sort.Slice(summary.Results, func(i, j int) bool {
+		return summary.Results[i].Path < summary.Results[j].Path
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, summary, err
+	}
+	if policy == LOAD_FAIL_FAST && firstErr != nil {
+		return nil, nil, summary, firstErr
+	}
+	if len(feeds) == 0 && firstErr != nil {
+		return nil, nil, summary, fmt.Errorf("no feed loaded: %v", firstErr)
+	}
+	return feeds, streams, summary, nil
+}
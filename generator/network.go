@@ -0,0 +1,659 @@
+package generator
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mapnificent/gogtfs"
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+const (
+	HOUR_RANGE               = int32(3)
+	IDENTICAL_STATION_RADIUS = 100.0
+	WALK_STATION_RADIUS      = 350.0
+)
+
+// GetNetwork builds the Mapnificent network of the loaded feeds. Feeds are
+// processed in the order of their ids, which also name the network. It
+// stops with the context error once ctx is done. Defaults of options are
+// filled in, see Options.Prepare.
+func GetNetwork(ctx context.Context, feeds map[string]*gtfs.Feed, ids FeedIds, streams StopTimeStreams, options *Options) (*mapnificent.MapnificentNetwork, *NetworkReport, error) {
+	if err := options.Prepare(); err != nil {
+		return nil, nil, err
+	}
+
+	network := new(mapnificent.MapnificentNetwork)
+	report := new(NetworkReport)
+
+	var name string
+
+	stationMap := make(map[string]uint)
+
+	var hierarchy StopHierarchy
+	if options.StopMerging == MERGE_STATION {
+		hierarchy = make(StopHierarchy)
+		for path := range feeds {
+			stopStations, err := readStopStations(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			hierarchy[path] = stopStations
+		}
+	}
+	var pathways *StationPathways
+	if options.Pathways {
+		pathways = &StationPathways{make(map[string]map[string]bool), make(map[string][]Transfer)}
+		for path := range feeds {
+			platforms, transfers, err := readStationPathways(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			pathways.platforms[path] = platforms
+			pathways.transfers[path] = transfers
+		}
+	}
+	stopSources := &StopSources{FeedIds: ids, Codes: make(map[string]map[string]string)}
+	for path := range feeds {
+		codes, err := readStopCodes(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		stopSources.Codes[path] = codes
+	}
+
+	// One index over the stops of all feeds serves both merging and walking
+	indexStart := time.Now()
+	spatialIndex := NewStopIndex(feeds, ids, math.Max(options.MergeRadius, options.WalkRadius))
+	options.Logger.Println("Indexed", len(spatialIndex.Stops), "stops in", time.Since(indexStart))
+	clusters := ClusterStops(spatialIndex, hierarchy, pathways, options.MergeRadius)
+
+	var walkGraph *WalkGraph
+	if options.OSMFile != "" {
+		var err error
+		bbox := GetStopsBoundingBox(feeds).Extend(options.WalkRadius * MAX_WALK_DETOUR)
+		walkGraph, err = LoadWalkGraph(ctx, options.OSMFile, bbox, options.Logger)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	droppedWalks := 0
+	walkLookups := 0
+	var walkLookupTime time.Duration
+
+	serviceDates := options.serviceDates
+	if options.RepresentativeWeek {
+		var err error
+		serviceDates, err = FindRepresentativeWeek(feeds, options.Logger)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if options.HourlyProfile && len(serviceDates) == 0 {
+		// Hourly profiles count the departures of concrete dates, so that
+		// overlapping calendars and single added dates are not counted on
+		// every such weekday. Without a date the representative week is
+		// used, which only keeps the trips running in that week.
+		options.Logger.Println("Hourly profile without a date, using the representative week")
+		var err error
+		serviceDates, err = FindRepresentativeWeek(feeds, options.Logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("hourly profile needs a date or a representative week: %v", err)
+		}
+	}
+
+	// Feeds, trips and lines are processed in sorted order so that the
+	// output is the same on every run
+	paths := sortedFeedPaths(feeds, ids)
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		feed := feeds[path]
+		options.Logger.Println("GetNetwork loop", path)
+
+		stopWalked := make(map[uint]bool)
+
+		if name == "" {
+			name = getNameFromPath(ids.Id(path))
+			// Store first feed id as name
+			network.Cityid = name
+		}
+
+		calendar, err := NewServiceCalendar(path, feed, serviceDates)
+		if err != nil {
+			return nil, nil, err
+		}
+		exactTimes, err := readFrequencyExactTimes(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lineMap := make(map[string]*list.List)
+		options.Logger.Println("Found", len(feed.Trips), "for", name)
+
+		tripIds := make([]string, 0, len(feed.Trips))
+		for tripId := range feed.Trips {
+			tripIds = append(tripIds, tripId)
+		}
+		sort.Strings(tripIds)
+		for _, tripId := range tripIds {
+			trip := feed.Trips[tripId]
+			if calendar.HasDates() && calendar.Weekdays(trip.ServiceId) == 0 {
+				// Trip does not run on any of the dates
+				continue
+			}
+			tripHash := GetLineHash(trip, options.LineGrouping)
+			if tripHash == "" {
+				// Trip without route
+				continue
+			}
+			_, ok := lineMap[tripHash]
+			if !ok {
+				lineMap[tripHash] = list.New()
+			}
+			lineMap[tripHash].PushBack(trip)
+		}
+		if options.LineGrouping == GROUP_SUBPATTERN {
+			MergeSubPatterns(lineMap)
+		}
+
+		lineHashes := make([]string, 0, len(lineMap))
+		for tripHash := range lineMap {
+			lineHashes = append(lineHashes, tripHash)
+		}
+		sort.Strings(lineHashes)
+		for _, tripHash := range lineHashes {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			li := lineMap[tripHash]
+			// Streamed feeds only hold the stop times of one line at a time
+			streams.Materialize(path, li)
+
+			trip := li.Front().Value.(*gtfs.Trip)
+
+			mapnificent_line := &mapnificent.MapnificentNetwork_Line{
+				LineId: trip.Id + "|" + trip.Route.Id,
+			}
+			if options.ExtraInfo {
+				routeName := GetRouteNamesFromTrips(li)
+				mapnificent_line.Name = routeName
+			}
+			var windowTrips, serviceTrips []*list.List
+			if options.HourlyProfile {
+				GetHourlyProfile(calendar, li, mapnificent_line)
+			} else {
+				windowTrips, serviceTrips = GetFrequencies(feed, calendar, exactTimes, li, mapnificent_line, options.ServiceWindows, options.IntervalMetric)
+			}
+
+			if len(mapnificent_line.LineTimes) == 0 && len(mapnificent_line.HourlyIntervals) == 0 {
+				streams.Release(path, li)
+				continue
+			}
+
+			network.Lines = append(network.Lines, mapnificent_line)
+			stopDepartures := GetStopDepartures(mapnificent_line, serviceTrips, exactTimes)
+			segmentTimes := GetSegmentTimes(windowTrips)
+
+			// Edges of all distinct stop patterns, so variants with extra
+			// or skipped stops are reachable as well
+			lineEdges := make(map[[2]uint]bool)
+			for _, patternTrip := range GetStopPatterns(li) {
+				var lastStopArrival, lastStopDeparture uint
+				var lastStop *mapnificent.MapnificentNetwork_Stop
+				var lastStopId string
+				var lastStopIndex uint
+
+				for _, stoptime := range patternTrip.StopTimes {
+					stopIndex := GetOrCreateMapnificentStop(path, stoptime.Stop, network, stationMap, clusters, stopSources, options.ExtraInfo)
+					mapnificentStop := network.Stops[stopIndex]
+
+					_, walkedOk := stopWalked[stopIndex]
+					if !walkedOk {
+						var reach *WalkReach
+						if walkGraph != nil {
+							reach = walkGraph.Reach(stoptime.Stop.Lat, stoptime.Stop.Lon, options.WalkRadius*MAX_WALK_DETOUR)
+						}
+						walkLookupStart := time.Now()
+						walkStopDistances := spatialIndex.Within(stoptime.Stop.Lat, stoptime.Stop.Lon, options.WalkRadius)
+						walkLookupTime += time.Since(walkLookupStart)
+						walkLookups += 1
+						sameStopWalked := make(map[uint]bool)
+						for _, walkStopDistance := range walkStopDistances {
+							if walkStopDistance.Path == path && walkStopDistance.Stop.Id == stoptime.Stop.Id {
+								// Same stop, continue
+								continue
+							}
+
+							walkStopIndex, exists := FindMapnificentStop(walkStopDistance.Path, walkStopDistance.Stop, stationMap, clusters)
+							if exists && (walkStopIndex == stopIndex || sameStopWalked[walkStopIndex]) {
+								continue
+							}
+							walkDistance := walkStopDistance.Distance
+							streets := false
+							if reach != nil {
+								var connected bool
+								walkDistance, streets, connected = reach.Distance(walkStopDistance.Stop.Lat, walkStopDistance.Stop.Lon)
+								if !connected {
+									// Separated by a river, rail line or motorway
+									droppedWalks += 1
+									continue
+								}
+							}
+							if !streets {
+								walkDistance *= options.WalkDetour
+							}
+							// Stops are only created for walks that are kept
+							walkStopIndex = GetOrCreateMapnificentStop(walkStopDistance.Path, walkStopDistance.Stop, network, stationMap, clusters, stopSources, options.ExtraInfo)
+							sameStopWalked[walkStopIndex] = true
+							walkTravelOption := new(mapnificent.MapnificentNetwork_Stop_TravelOption)
+							walkTravelOption.Stop = uint32(walkStopIndex)
+							SetWalk(walkTravelOption, walkDistance, options)
+							mapnificentStop.TravelOptions = append(mapnificentStop.TravelOptions, walkTravelOption)
+						}
+						stopWalked[stopIndex] = true
+					}
+
+					edge := [2]uint{lastStopIndex, stopIndex}
+					if lastStop != nil && !lineEdges[edge] {
+						lineEdges[edge] = true
+						delta := stoptime.ArrivalTime - lastStopDeparture
+						stayDelta := lastStopDeparture - lastStopArrival
+						travelOption := new(mapnificent.MapnificentNetwork_Stop_TravelOption)
+						travelOption.Stop = uint32(stopIndex)
+						travelOption.TravelTime = uint32(delta)
+						travelOption.StayTime = uint32(stayDelta)
+						travelOption.Line = mapnificent_line.LineId
+						travelOption.StopIntervals = GetStopIntervals(mapnificent_line, stopDepartures, lastStopId, options.IntervalMetric)
+						travelOption.TravelTimes, travelOption.StayTimes = GetWindowTravelTimes(segmentTimes, lastStopId, stoptime.Stop.Id, travelOption.TravelTime, travelOption.StayTime)
+						lastStop.TravelOptions = append(lastStop.TravelOptions, travelOption)
+					}
+					lastStopArrival = stoptime.ArrivalTime
+					lastStopDeparture = stoptime.DepartureTime
+					lastStop = mapnificentStop
+					lastStopId = stoptime.Stop.Id
+					lastStopIndex = stopIndex
+				}
+			}
+			streams.Release(path, li)
+		}
+	}
+	report.ReverseWalks = SymmetrizeWalks(network)
+	if report.ReverseWalks > 0 {
+		options.Logger.Println("Added", report.ReverseWalks, "reverse walks")
+	}
+	report.PrunedWalks = PruneWalks(network, options)
+	// Transfers are applied last so that they replace the walks of all
+	// feeds and are not pruned, transfers.txt overrides in-station transfers
+	for _, path := range paths {
+		ApplyPathwayTransfers(path, feeds[path], pathways.Transfers(path), network, stationMap, clusters, stopSources, options)
+		transfers, err := readTransfers(path, options.Logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		ApplyTransfers(path, feeds[path], transfers, network, stationMap, clusters, stopSources, walkGraph, options)
+	}
+	deadEnds := FindDeadEnds(network)
+	report.DeadEnds = len(deadEnds)
+	options.Logger.Println("Found", len(deadEnds), "stops without travel options")
+	if options.ExtraInfo {
+		for _, i := range deadEnds {
+			options.Logger.Println("Dead end:", network.Stops[i].Name)
+		}
+	}
+	if options.RemoveDeadEnds {
+		var removedOptions int
+		report.RemovedDeadEnds, removedOptions = RemoveDeadEnds(network)
+		options.Logger.Println("Removed", report.RemovedDeadEnds, "dead end stops and", removedOptions, "travel options leading to them")
+	}
+	options.Logger.Println("Looked up walks of", walkLookups, "stops in", walkLookupTime)
+	if walkGraph != nil {
+		options.Logger.Println("Dropped", droppedWalks, "walks not connected by the street network")
+	}
+	report.Stops = len(network.Stops)
+	report.Lines = len(network.Lines)
+	report.WalkLookups, report.WalkLookupTime = walkLookups, walkLookupTime
+	report.DroppedWalks = droppedWalks
+	return network, report, nil
+}
+
+// SetWalk sets the walk distance in meters of a travel option, or the walk
+// time if a walking speed is configured
+func SetWalk(travelOption *mapnificent.MapnificentNetwork_Stop_TravelOption, distance float64, options *Options) {
+	if options.WalkSpeed > 0 {
+		travelOption.WalkTime = uint32(round(distance / options.WalkSpeed))
+	} else {
+		travelOption.WalkDistance = uint32(distance)
+	}
+}
+
+// FindMapnificentStop returns the index of the network stop for stop,
+// or of the stop its cluster was merged into, ok is false if there is none
+func FindMapnificentStop(path string, stop *gtfs.Stop,
+	stationMap map[string]uint,
+	clusters *StopClusters) (stopIndex uint, ok bool) {
+	stopIndex, ok = stationMap[fmt.Sprintf("%s_%s", path, stop.Id)]
+	if ok {
+		return stopIndex, true
+	}
+	if cluster := clusters.Get(path, stop.Id); cluster != nil {
+		stopIndex, ok = stationMap[cluster.Key]
+	}
+	return stopIndex, ok
+}
+
+func GetOrCreateMapnificentStop(path string, stop *gtfs.Stop,
+	network *mapnificent.MapnificentNetwork,
+	stationMap map[string]uint,
+	clusters *StopClusters,
+	stopSources *StopSources,
+	extraInfo bool) uint {
+	stationName := fmt.Sprintf("%s_%s", path, stop.Id)
+	stopIndex, ok := stationMap[stationName]
+	if !ok {
+		// All stops of a cluster are identical
+		cluster := clusters.Get(path, stop.Id)
+		foundStopIndex := -1
+		if cluster != nil {
+			if clusterIndex, ok := stationMap[cluster.Key]; ok {
+				foundStopIndex = int(clusterIndex)
+			}
+		}
+		if foundStopIndex == -1 {
+			mapnificentStop := &mapnificent.MapnificentNetwork_Stop{}
+			mapnificentStop.Latitude = stop.Lat
+			mapnificentStop.Longitude = stop.Lon
+			if cluster != nil {
+				mapnificentStop.Latitude = cluster.Lat
+				mapnificentStop.Longitude = cluster.Lon
+			}
+			if extraInfo {
+				stopName := stop.Name + " (" + stop.Id + ")"
+				mapnificentStop.Name = stopName
+			}
+			network.Stops = append(network.Stops, mapnificentStop)
+			stopIndex = uint(len(network.Stops) - 1)
+		} else {
+			stopIndex = uint(foundStopIndex)
+			if extraInfo {
+				mapnificentStopName := network.Stops[stopIndex].GetName()
+				mapnificentStopName = mapnificentStopName + " | " + stop.Name + " (" + stop.Id + ")"
+				network.Stops[stopIndex].Name = mapnificentStopName
+			}
+		}
+		stationMap[stationName] = stopIndex
+		network.Stops[stopIndex].Sources = append(network.Stops[stopIndex].Sources, stopSources.NewStopSource(path, stop))
+		if cluster != nil {
+			stationMap[cluster.Key] = stopIndex
+		}
+	}
+	return stopIndex
+}
+
+func b2i(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func GetWeekdaysForServiceId(feed *gtfs.Feed, serviceId string) (weekdays int32) {
+	weekdays = 0
+	if calendar, ok := feed.Calendars[serviceId]; ok {
+		weekdays = weekdays | (b2i(calendar.Monday) << 0)
+		weekdays = weekdays | (b2i(calendar.Tuesday) << 1)
+		weekdays = weekdays | (b2i(calendar.Wednesday) << 2)
+		weekdays = weekdays | (b2i(calendar.Thursday) << 3)
+		weekdays = weekdays | (b2i(calendar.Friday) << 4)
+		weekdays = weekdays | (b2i(calendar.Saturday) << 5)
+		weekdays = weekdays | (b2i(calendar.Sunday) << 6)
+	}
+	return weekdays
+}
+
+func round(val float64) int {
+	if val < 0 {
+		return int(val - 0.5)
+	}
+	return int(val + 0.5)
+}
+
+// GetFrequencies adds a LineTime to line for every service window the
+// trips run in. It returns the trips each LineTime is based on, those
+// departing from their first stop within the window, and all trips
+// running on the days of each LineTime.
+func GetFrequencies(feed *gtfs.Feed, calendar *ServiceCalendar, exactTimes FrequencyExactTimes, trips *list.List, line *mapnificent.MapnificentNetwork_Line, windows []ServiceWindow, metric IntervalMetric) (windowTrips []*list.List, serviceTrips []*list.List) {
+	service_trips := make(map[int]*list.List)
+
+	// Go through all service windows and record associated trips
+	for i, window := range windows {
+		service_day := window.Weekdays
+
+		for trip := trips.Front(); trip != nil; trip = trip.Next() {
+			realTrip := trip.Value.(*gtfs.Trip)
+			weekdays := calendar.Weekdays(realTrip.ServiceId)
+			if service_day&weekdays >= service_day {
+				_, ok := service_trips[i]
+				if !ok {
+					service_trips[i] = list.New()
+				}
+				service_trips[i].PushBack(realTrip)
+			}
+		}
+		st, ok := service_trips[i]
+		if (!ok || st.Len() == 0) && !calendar.HasDates() {
+			// This trip might be modelled via exceptions
+			// Find best serviceID in exceptions that provides
+			// services in service range
+			// This is a hack: we are trying to find regularities in
+			// exceptions.
+
+			serviceIdCount := make(map[string]int)
+			mostCommonId := ""
+			mostCommonIdCount := 0
+
+			for trip := trips.Front(); trip != nil; trip = trip.Next() {
+				realTrip := trip.Value.(*gtfs.Trip)
+				if len(realTrip.StopTimes) == 0 {
+					continue
+				}
+				depTime := realTrip.StopTimes[0].DepartureTime
+				depHour := int32(depTime / (60 * 60))
+				// If departure time of is not within service hour range
+				if !window.ContainsHour(depHour) {
+					continue
+				}
+
+				_, sid_ok := serviceIdCount[realTrip.ServiceId]
+				if !sid_ok {
+					if calendardates, cd_ok := feed.CalendarDates[realTrip.ServiceId]; cd_ok {
+						for _, calendardate := range calendardates {
+							if calendardate.ExceptionType != 1 {
+								continue
+							}
+
+							strdate := strconv.Itoa(calendardate.Date)
+							t, err := time.Parse(DATE_LAYOUT, strdate)
+							if err != nil {
+								continue
+							}
+							wd := t.Weekday()
+							var weekdays int32 = 0
+							if wd == 0 {
+								weekdays = weekdays | (1 << 6)
+							} else {
+								weekdays = weekdays | (1 << (uint(wd) - 1))
+							}
+							if service_day&weekdays == 0 {
+								continue
+							}
+
+							count, count_ok := serviceIdCount[realTrip.ServiceId]
+							var lastCount int
+							if !count_ok {
+								serviceIdCount[realTrip.ServiceId] = 1
+								lastCount = 1
+							} else {
+								serviceIdCount[realTrip.ServiceId] = count + 1
+								lastCount = count + 1
+							}
+							if lastCount > mostCommonIdCount {
+								mostCommonIdCount = lastCount
+								mostCommonId = realTrip.ServiceId
+							}
+						}
+					}
+				}
+			}
+			if mostCommonIdCount != 0 {
+				for trip := trips.Front(); trip != nil; trip = trip.Next() {
+					realTrip := trip.Value.(*gtfs.Trip)
+					if realTrip.ServiceId != mostCommonId {
+						continue
+					}
+					if len(realTrip.StopTimes) == 0 {
+						continue
+					}
+					depTime := realTrip.StopTimes[0].DepartureTime
+					depHour := int32(depTime / (60 * 60))
+					// If departure time of is not within service hour range
+					if !window.ContainsHour(depHour) {
+						continue
+					}
+					_, ok := service_trips[i]
+					if !ok {
+						service_trips[i] = list.New()
+					}
+					service_trips[i].PushBack(realTrip)
+				}
+			}
+		}
+	}
+
+	for i, window := range windows {
+		tripList, ok := service_trips[i]
+
+		if !ok {
+			// Found no trips for this service id
+			continue
+		}
+		if tripList.Len() == 0 {
+			continue
+		}
+
+		if window.Weekdays == 0 {
+			// Runs on no days
+			continue
+		}
+
+		// Scheduled departures and departures from frequencies.txt
+		// weighted by their overlap with the window. Only trips departing
+		// in the window are kept for stop intervals and travel times.
+		depTimes := make([]int, 0, tripList.Len())
+		departingTrips := list.New()
+		for trip := tripList.Front(); trip != nil; trip = trip.Next() {
+			realTrip := trip.Value.(*gtfs.Trip)
+			tripDepTimes := GetTripDepartures(realTrip, window, exactTimes)
+			if len(tripDepTimes) == 0 {
+				continue
+			}
+			depTimes = append(depTimes, tripDepTimes...)
+			departingTrips.PushBack(realTrip)
+		}
+
+		stats, ok := GetHeadwayStats(depTimes)
+
+		if ok && stats.Interval(metric) > 0 {
+			mapnificent_line_time := NewLineTime(window, stats, metric)
+			line.LineTimes = append(line.LineTimes, &mapnificent_line_time)
+			windowTrips = append(windowTrips, departingTrips)
+			serviceTrips = append(serviceTrips, tripList)
+		}
+	}
+	return windowTrips, serviceTrips
+}
+
+func GetRouteNamesFromTrips(trips *list.List) string {
+	var buffer bytes.Buffer
+	nameUsed := make(map[string]bool)
+
+	i := 0
+	for trip := trips.Front(); trip != nil; trip = trip.Next() {
+		realTrip := trip.Value.(*gtfs.Trip)
+		route := realTrip.Route
+		if route == nil {
+			continue
+		}
+		_, ok := nameUsed[route.Id]
+		if !ok {
+			if i > 0 {
+				buffer.WriteString(" | ")
+			}
+			if route.LongName != "" {
+				buffer.WriteString(route.LongName)
+			} else {
+				buffer.WriteString(route.ShortName)
+			}
+			buffer.WriteString(" (")
+			if route.LongName != "" {
+				buffer.WriteString(route.ShortName)
+				buffer.WriteString(",")
+			}
+			buffer.WriteString(route.Id)
+			buffer.WriteString(")")
+			nameUsed[route.Id] = true
+			i += 1
+		}
+	}
+
+	return buffer.String()
+}
+
+func NewLineTime(window ServiceWindow, stats HeadwayStats, metric IntervalMetric) mapnificent.MapnificentNetwork_Line_LineTime {
+	return mapnificent.MapnificentNetwork_Line_LineTime{
+		Interval:     uint32(stats.Interval(metric)),
+		Start:        uint32(window.Start),
+		Stop:         uint32(window.End()),
+		Weekday:      uint32(window.Weekdays),
+		ExpectedWait: uint32(round(stats.ExpectedWait)),
+		MaxGap:       uint32(stats.MaxGap),
+		TripCount:    uint32(stats.Trips),
+	}
+}
+
+func GetTripHash(trip *gtfs.Trip) string {
+	/* Gets a hash based on route and the actual trip stops */
+	if trip.Route == nil {
+		// Trips without route belong to no line
+		return ""
+	}
+	h := md5.New()
+	io.WriteString(h, trip.Route.Id)
+	io.WriteString(h, "||")
+	if !trip.HasDirection && trip.Headsign == "" {
+		for _, stoptime := range trip.StopTimes {
+			io.WriteString(h, stoptime.Stop.Id)
+			io.WriteString(h, "||")
+		}
+	} else {
+		io.WriteString(h, trip.Headsign)
+		io.WriteString(h, "||")
+		io.WriteString(h, hex.EncodeToString([]byte{trip.Direction}))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:])
+}
+
+func getNameFromPath(path string) string {
+	pathParts := strings.Split(path, "/")
+	return pathParts[len(pathParts)-1]
+}
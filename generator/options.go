@@ -0,0 +1,174 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Options holds the options for generating a network. The command line
+// reads them from the JSON file given with -c and completes them by flags.
+type Options struct {
+	ServiceWindows []ServiceWindow `json:"service_windows"`
+	HourlyProfile  bool            `json:"hourly_profile"`
+	ExtraInfo      bool            `json:"extra_info"`
+	// Only use trips running on this date (YYYY-MM-DD)
+	Date string `json:"date"`
+	// Only use trips running in the most typical week of all calendars
+	RepresentativeWeek bool `json:"representative_week"`
+	// Headway metric stored as line interval
+	IntervalMetric IntervalMetric `json:"interval_metric"`
+	// How trips are grouped into lines
+	LineGrouping LineGrouping `json:"line_grouping"`
+	// How stops are merged into Mapnificent stops
+	StopMerging StopMerging `json:"stop_merging"`
+	// OpenStreetMap PBF extract for walking distances along streets
+	OSMFile string `json:"osm_file"`
+	// Keep platforms of stations with pathways.txt as separate stops
+	Pathways bool `json:"pathways"`
+	// Stops within this distance in meters are merged
+	MergeRadius float64 `json:"merge_radius"`
+	// Stops within this distance in meters are connected by walking
+	WalkRadius float64 `json:"walk_radius"`
+	// Walking speed in meters per second, if set walk times are emitted
+	// instead of walk distances
+	WalkSpeed float64 `json:"walk_speed"`
+	// Factor applied to straight-line walking distances for the detours
+	// of the actual way
+	WalkDetour float64 `json:"walk_detour"`
+	// Keep only this many nearest walks per stop
+	WalkNearest int `json:"walk_nearest"`
+	// Drop walks that a chain of two shorter walks at most this many times
+	// as long replaces
+	WalkChainFactor float64 `json:"walk_chain_factor"`
+	// Drop walks between stops served by exactly the same lines
+	PruneSameLineWalks bool `json:"prune_same_line_walks"`
+	// Remove stops without travel options
+	RemoveDeadEnds bool `json:"remove_dead_ends"`
+	// Number of feeds loaded at the same time
+	LoadWorkers int `json:"load_workers"`
+	// What to do when a feed fails to load
+	LoadPolicy LoadPolicy `json:"load_policy"`
+	// Read stop times in a single pass without holding all in memory
+	Streaming bool `json:"streaming"`
+	// Glob patterns for the feeds to load and the files and directories to
+	// leave out when searching directories
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Progress and statistics are logged here, nothing is logged if unset
+	Logger *log.Logger `json:"-"`
+
+	serviceDates []time.Time
+}
+
+// Prepare fills in defaults and checks the options, New and GetNetwork
+// call it. Calling it again leaves prepared options unchanged.
+func (o *Options) Prepare() error {
+	if o.Logger == nil {
+		o.Logger = log.New(io.Discard, "", 0)
+	}
+	if len(o.ServiceWindows) == 0 {
+		o.ServiceWindows = defaultServiceWindows
+	}
+	// Durations are filled in, do not change the windows of the caller
+	o.ServiceWindows = append([]ServiceWindow(nil), o.ServiceWindows...)
+	for i := range o.ServiceWindows {
+		if o.ServiceWindows[i].Duration == 0 {
+			o.ServiceWindows[i].Duration = HOUR_RANGE
+		}
+		if err := o.ServiceWindows[i].validate(); err != nil {
+			return fmt.Errorf("service window %d: %v", i, err)
+		}
+	}
+	switch o.IntervalMetric {
+	case "":
+		o.IntervalMetric = INTERVAL_MEAN
+	case INTERVAL_MEAN, INTERVAL_WAIT, INTERVAL_MAX:
+	default:
+		return fmt.Errorf("unknown interval metric %q", o.IntervalMetric)
+	}
+	switch o.LineGrouping {
+	case "":
+		o.LineGrouping = GROUP_HEADSIGN
+	case GROUP_HEADSIGN, GROUP_PATTERN, GROUP_SUBPATTERN:
+	default:
+		return fmt.Errorf("unknown line grouping %q", o.LineGrouping)
+	}
+	switch o.StopMerging {
+	case "":
+		o.StopMerging = MERGE_RADIUS
+	case MERGE_RADIUS, MERGE_STATION:
+	default:
+		return fmt.Errorf("unknown stop merging %q", o.StopMerging)
+	}
+	if o.MergeRadius == 0 {
+		o.MergeRadius = IDENTICAL_STATION_RADIUS
+	}
+	if o.WalkRadius == 0 {
+		o.WalkRadius = WALK_STATION_RADIUS
+	}
+	if o.WalkDetour == 0 {
+		o.WalkDetour = 1.0
+	}
+	if o.MergeRadius < 0 || o.WalkRadius < 0 {
+		return errors.New("merge and walk radius must be positive")
+	}
+	if o.WalkSpeed < 0 {
+		return errors.New("walk speed must be positive")
+	}
+	if o.WalkDetour < 1 {
+		return fmt.Errorf("walk detour %g must be at least 1", o.WalkDetour)
+	}
+	if o.WalkNearest < 0 {
+		return errors.New("walk nearest must be positive")
+	}
+	if o.WalkChainFactor != 0 && o.WalkChainFactor < 1 {
+		return fmt.Errorf("walk chain factor %g must be at least 1", o.WalkChainFactor)
+	}
+	if o.LoadWorkers == 0 {
+		o.LoadWorkers = runtime.NumCPU()
+	}
+	if o.LoadWorkers < 0 {
+		return errors.New("load workers must be positive")
+	}
+	switch o.LoadPolicy {
+	case "":
+		o.LoadPolicy = LOAD_FAIL_FAST
+	case LOAD_FAIL_FAST, LOAD_SKIP_BAD:
+	default:
+		return fmt.Errorf("unknown load policy %q", o.LoadPolicy)
+	}
+	for _, pattern := range append(append([]string(nil), o.Include...), o.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	o.serviceDates = nil
+	if o.Date != "" && o.RepresentativeWeek {
+		return errors.New("date and representative week cannot be combined")
+	}
+	if o.Date != "" {
+		date, err := time.Parse("2006-01-02", o.Date)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", o.Date)
+		}
+		o.serviceDates = []time.Time{date}
+		// Service windows only apply to the weekday of the date
+		windows := make([]ServiceWindow, 0, len(o.ServiceWindows))
+		seen := make(map[ServiceWindow]bool)
+		for _, window := range o.ServiceWindows {
+			window.Weekdays = weekdayBit(date.Weekday())
+			if seen[window] {
+				continue
+			}
+			seen[window] = true
+			windows = append(windows, window)
+		}
+		o.ServiceWindows = windows
+	}
+	return nil
+}
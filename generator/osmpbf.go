@@ -0,0 +1,313 @@
+package generator
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Minimal reader for OpenStreetMap PBF files, see
+// https://wiki.openstreetmap.org/wiki/PBF_Format
+// Only nodes and ways are read, relations are skipped.
+
+const (
+	MAX_PBF_HEADER_SIZE = 64 * 1024
+	MAX_PBF_BLOB_SIZE   = 32 * 1024 * 1024
+)
+
+type osmWay struct {
+	Id   int64
+	Refs []int64
+	Tags map[string]string
+}
+
+// pbfFields calls fn for every field of the protobuf message data.
+// value holds varint and fixed values, bytes the length delimited ones.
+func pbfFields(data []byte, fn func(field int, value uint64, bytes []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("osm pbf: invalid field key")
+		}
+		data = data[n:]
+		field := int(key >> 3)
+		var value uint64
+		var content []byte
+		switch key & 7 {
+		case 0:
+			value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("osm pbf: invalid varint")
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errors.New("osm pbf: truncated fixed64")
+			}
+			value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errors.New("osm pbf: truncated field")
+			}
+			content = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case 5:
+			if len(data) < 4 {
+				return errors.New("osm pbf: truncated fixed32")
+			}
+			value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return fmt.Errorf("osm pbf: unsupported wire type %d", key&7)
+		}
+		if err := fn(field, value, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pbfPackedVarints(data []byte) ([]uint64, error) {
+	values := make([]uint64, 0, len(data))
+	for len(data) > 0 {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("osm pbf: invalid packed varint")
+		}
+		values = append(values, value)
+		data = data[n:]
+	}
+	return values, nil
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// readOSMPbf reads nodes and ways from an OSM PBF stream
+func readOSMPbf(r io.Reader, handleNode func(id int64, lat float64, lon float64), handleWay func(way *osmWay)) error {
+	sizeBuf := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, sizeBuf); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		headerSize := binary.BigEndian.Uint32(sizeBuf)
+		if headerSize > MAX_PBF_HEADER_SIZE {
+			return errors.New("osm pbf: blob header too large")
+		}
+		header := make([]byte, headerSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		var blobType string
+		var blobSize uint64
+		err := pbfFields(header, func(field int, value uint64, content []byte) error {
+			switch field {
+			case 1:
+				blobType = string(content)
+			case 3:
+				blobSize = value
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if blobSize > MAX_PBF_BLOB_SIZE {
+			return errors.New("osm pbf: blob too large")
+		}
+		blob := make([]byte, blobSize)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return err
+		}
+		if blobType != "OSMData" {
+			continue
+		}
+		data, err := decodePbfBlob(blob)
+		if err != nil {
+			return err
+		}
+		if err := readPrimitiveBlock(data, handleNode, handleWay); err != nil {
+			return err
+		}
+	}
+}
+
+func decodePbfBlob(blob []byte) ([]byte, error) {
+	var raw, zlibData []byte
+	err := pbfFields(blob, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			raw = content
+		case 3:
+			zlibData = content
+		case 4, 5, 6, 7:
+			return errors.New("osm pbf: unsupported blob compression")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if raw != nil {
+		return raw, nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(zlibData))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+func readPrimitiveBlock(data []byte, handleNode func(id int64, lat float64, lon float64), handleWay func(way *osmWay)) error {
+	var stringTable []string
+	var groups [][]byte
+	var granularity int64 = 100
+	var latOffset, lonOffset int64
+	err := pbfFields(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			return pbfFields(content, func(field int, value uint64, s []byte) error {
+				if field == 1 {
+					stringTable = append(stringTable, string(s))
+				}
+				return nil
+			})
+		case 2:
+			groups = append(groups, content)
+		case 17:
+			granularity = int64(value)
+		case 19:
+			latOffset = int64(value)
+		case 20:
+			lonOffset = int64(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	coordinate := func(offset int64, value int64) float64 {
+		return 1e-9 * float64(offset+granularity*value)
+	}
+	for _, group := range groups {
+		err := pbfFields(group, func(field int, value uint64, content []byte) error {
+			switch field {
+			case 1:
+				return readPbfNode(content, func(id int64, lat int64, lon int64) {
+					handleNode(id, coordinate(latOffset, lat), coordinate(lonOffset, lon))
+				})
+			case 2:
+				return readPbfDenseNodes(content, func(id int64, lat int64, lon int64) {
+					handleNode(id, coordinate(latOffset, lat), coordinate(lonOffset, lon))
+				})
+			case 3:
+				way, err := readPbfWay(content, stringTable)
+				if err != nil {
+					return err
+				}
+				handleWay(way)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readPbfNode(data []byte, fn func(id int64, lat int64, lon int64)) error {
+	var id, lat, lon int64
+	err := pbfFields(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			id = zigzag(value)
+		case 8:
+			lat = zigzag(value)
+		case 9:
+			lon = zigzag(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fn(id, lat, lon)
+	return nil
+}
+
+func readPbfDenseNodes(data []byte, fn func(id int64, lat int64, lon int64)) error {
+	var ids, lats, lons []uint64
+	err := pbfFields(data, func(field int, value uint64, content []byte) error {
+		var err error
+		switch field {
+		case 1:
+			ids, err = pbfPackedVarints(content)
+		case 8:
+			lats, err = pbfPackedVarints(content)
+		case 9:
+			lons, err = pbfPackedVarints(content)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return errors.New("osm pbf: inconsistent dense nodes")
+	}
+	// Values are delta coded
+	var id, lat, lon int64
+	for i := range ids {
+		id += zigzag(ids[i])
+		lat += zigzag(lats[i])
+		lon += zigzag(lons[i])
+		fn(id, lat, lon)
+	}
+	return nil
+}
+
+func readPbfWay(data []byte, stringTable []string) (*osmWay, error) {
+	way := &osmWay{Tags: make(map[string]string)}
+	var keys, vals, refs []uint64
+	err := pbfFields(data, func(field int, value uint64, content []byte) error {
+		var err error
+		switch field {
+		case 1:
+			way.Id = int64(value)
+		case 2:
+			keys, err = pbfPackedVarints(content)
+		case 3:
+			vals, err = pbfPackedVarints(content)
+		case 8:
+			refs, err = pbfPackedVarints(content)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(keys) && i < len(vals); i++ {
+		if keys[i] >= uint64(len(stringTable)) || vals[i] >= uint64(len(stringTable)) {
+			return nil, errors.New("osm pbf: invalid string table index")
+		}
+		way.Tags[stringTable[keys[i]]] = stringTable[vals[i]]
+	}
+	// Refs are delta coded
+	var ref int64
+	way.Refs = make([]int64, len(refs))
+	for i, r := range refs {
+		ref += zigzag(r)
+		way.Refs[i] = ref
+	}
+	return way, nil
+}
@@ -0,0 +1,185 @@
+package generator
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"sort"
+	"testing"
+)
+
+type testOSMNode struct {
+	id       int64
+	lat, lon float64
+}
+
+type testOSMWay struct {
+	id   int64
+	refs []int64
+	tags map[string]string
+}
+
+func appendPbfVarint(b []byte, field int, value uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3))
+	return binary.AppendUvarint(b, value)
+}
+
+func appendPbfBytes(b []byte, field int, content []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(content)))
+	return append(b, content...)
+}
+
+// appendPbfPacked appends values as packed varints, delta and zigzag
+// coded if delta is set
+func appendPbfPacked(b []byte, field int, values []int64, delta bool) []byte {
+	var packed []byte
+	var last int64
+	for _, v := range values {
+		if delta {
+			v, last = v-last, v
+			packed = binary.AppendUvarint(packed, uint64(v<<1^v>>63))
+		} else {
+			packed = binary.AppendUvarint(packed, uint64(v))
+		}
+	}
+	return appendPbfBytes(b, field, packed)
+}
+
+// appendPbfBlob appends a blob with header, zlib compressed unless raw
+func appendPbfBlob(b []byte, blobType string, data []byte, raw bool) []byte {
+	var blob []byte
+	if raw {
+		blob = appendPbfBytes(blob, 1, data)
+	} else {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write(data)
+		w.Close()
+		blob = appendPbfVarint(blob, 2, uint64(len(data)))
+		blob = appendPbfBytes(blob, 3, compressed.Bytes())
+	}
+	var header []byte
+	header = appendPbfBytes(header, 1, []byte(blobType))
+	header = appendPbfVarint(header, 3, uint64(len(blob)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(header)))
+	b = append(b, header...)
+	return append(b, blob...)
+}
+
+// encodeTestPbf encodes nodes as dense nodes and ways in one zlib
+// compressed primitive block, after an uncompressed header block
+func encodeTestPbf(nodes []testOSMNode, ways []testOSMWay) []byte {
+	stringTable := []string{""}
+	stringIndex := func(s string) int64 {
+		for i, known := range stringTable {
+			if known == s {
+				return int64(i)
+			}
+		}
+		stringTable = append(stringTable, s)
+		return int64(len(stringTable) - 1)
+	}
+
+	var dense []byte
+	ids := make([]int64, len(nodes))
+	lats := make([]int64, len(nodes))
+	lons := make([]int64, len(nodes))
+	for i, node := range nodes {
+		// Default granularity of 100 nanodegrees
+		ids[i] = node.id
+		lats[i] = int64(math.Round(node.lat * 1e7))
+		lons[i] = int64(math.Round(node.lon * 1e7))
+	}
+	dense = appendPbfPacked(dense, 1, ids, true)
+	dense = appendPbfPacked(dense, 8, lats, true)
+	dense = appendPbfPacked(dense, 9, lons, true)
+	var group []byte
+	group = appendPbfBytes(group, 2, dense)
+
+	for _, way := range ways {
+		var keys, vals []int64
+		for _, key := range sortedKeys(way.tags) {
+			keys = append(keys, stringIndex(key))
+			vals = append(vals, stringIndex(way.tags[key]))
+		}
+		var w []byte
+		w = appendPbfVarint(w, 1, uint64(way.id))
+		w = appendPbfPacked(w, 2, keys, false)
+		w = appendPbfPacked(w, 3, vals, false)
+		w = appendPbfPacked(w, 8, way.refs, true)
+		group = appendPbfBytes(group, 3, w)
+	}
+
+	var table []byte
+	for _, s := range stringTable {
+		table = appendPbfBytes(table, 1, []byte(s))
+	}
+	var block []byte
+	block = appendPbfBytes(block, 1, table)
+	block = appendPbfBytes(block, 2, group)
+
+	var file []byte
+	file = appendPbfBlob(file, "OSMHeader", []byte{}, true)
+	return appendPbfBlob(file, "OSMData", block, false)
+}
+
+func sortedKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestReadOSMPbf(t *testing.T) {
+	// Ids, latitudes and longitudes go down as well, for negative deltas
+	nodes := []testOSMNode{{10, 52.5, 13.4}, {12, 52.5001, 13.3999}, {11, -33.9, -151.2}}
+	ways := []testOSMWay{
+		{7, []int64{10, 12, 11}, map[string]string{"highway": "footway", "name": "Weg"}},
+		{3, []int64{12, 10}, nil},
+	}
+	var gotNodes []testOSMNode
+	var gotWays []*osmWay
+	err := readOSMPbf(bytes.NewReader(encodeTestPbf(nodes, ways)), func(id int64, lat float64, lon float64) {
+		gotNodes = append(gotNodes, testOSMNode{id, lat, lon})
+	}, func(way *osmWay) {
+		gotWays = append(gotWays, way)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gotNodes) != len(nodes) {
+		t.Fatalf("got %d nodes, want %d", len(gotNodes), len(nodes))
+	}
+	for i, node := range nodes {
+		got := gotNodes[i]
+		if got.id != node.id || math.Abs(got.lat-node.lat) > 1e-9 || math.Abs(got.lon-node.lon) > 1e-9 {
+			t.Errorf("node %d: got %v, want %v", i, got, node)
+		}
+	}
+	if len(gotWays) != len(ways) {
+		t.Fatalf("got %d ways, want %d", len(gotWays), len(ways))
+	}
+	for i, way := range ways {
+		got := gotWays[i]
+		if got.Id != way.id || len(got.Refs) != len(way.refs) || len(got.Tags) != len(way.tags) {
+			t.Errorf("way %d: got %+v, want %+v", i, got, way)
+			continue
+		}
+		for j, ref := range way.refs {
+			if got.Refs[j] != ref {
+				t.Errorf("way %d: got refs %v, want %v", i, got.Refs, way.refs)
+				break
+			}
+		}
+		for key, value := range way.tags {
+			if got.Tags[key] != value {
+				t.Errorf("way %d: got tag %s=%s, want %s", i, key, got.Tags[key], value)
+			}
+		}
+	}
+}
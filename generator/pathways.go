@@ -0,0 +1,215 @@
+package generator
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/mapnificent/gogtfs"
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+const (
+	// Walking speed in meters per second in pathways without traversal_time
+	PATHWAY_WALK_SPEED = 1.0
+	// Time in seconds per level for pathways without length or traversal_time
+	PATHWAY_LEVEL_TIME = 30.0
+	// Time in seconds for pathways without length, traversal_time or levels
+	PATHWAY_DEFAULT_TIME = 30.0
+)
+
+// StationPathways holds the platforms of the stations that have pathways
+// and the in-station transfer times between them. These platforms stay
+// separate Mapnificent stops instead of being merged.
+type StationPathways struct {
+	platforms map[string]map[string]bool
+	transfers map[string][]Transfer
+}
+
+// IsSeparate tells whether a stop is a platform of a station with pathways,
+// it is safe to call on nil
+func (p *StationPathways) IsSeparate(path string, stopId string) bool {
+	if p == nil {
+		return false
+	}
+	return p.platforms[path][stopId]
+}
+
+// Transfers returns the in-station transfers of a feed, MinTransferTime is
+// the fastest way through the pathways from one platform to the other
+func (p *StationPathways) Transfers(path string) []Transfer {
+	if p == nil {
+		return nil
+	}
+	return p.transfers[path]
+}
+
+type pathwayEdge struct {
+	to   int32
+	time float64
+}
+
+// readStationPathways reads pathways.txt and levels.txt of the feed at path
+// and computes the transfer times between the platforms of every station
+// with pathways. Boarding areas count as part of their platform.
+func readStationPathways(path string) (platforms map[string]bool, transfers []Transfer, err error) {
+	stopStations, err := readStopStations(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	levelIndex := make(map[string]float64)
+	_, err = readGtfsCsv(path, "levels.txt", func(row map[string]string) error {
+		index, err := strconv.ParseFloat(row["level_index"], 64)
+		if err == nil {
+			levelIndex[row["level_id"]] = index
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	locationTypes := make(map[string]string)
+	parents := make(map[string]string)
+	stopLevels := make(map[string]float64)
+	_, err = readGtfsCsv(path, "stops.txt", func(row map[string]string) error {
+		stopId := row["stop_id"]
+		locationTypes[stopId] = row["location_type"]
+		parents[stopId] = row["parent_station"]
+		if index, ok := levelIndex[row["level_id"]]; ok {
+			stopLevels[stopId] = index
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodeIndex := make(map[string]int32)
+	node := func(stopId string) int32 {
+		if locationTypes[stopId] == "4" && parents[stopId] != "" {
+			stopId = parents[stopId]
+		}
+		index, ok := nodeIndex[stopId]
+		if !ok {
+			index = int32(len(nodeIndex))
+			nodeIndex[stopId] = index
+		}
+		return index
+	}
+	edges := make(map[int32][]pathwayEdge)
+	stations := make(map[string]bool)
+	_, err = readGtfsCsv(path, "pathways.txt", func(row map[string]string) error {
+		from, to := row["from_stop_id"], row["to_stop_id"]
+		time, _ := strconv.ParseFloat(row["traversal_time"], 64)
+		if time <= 0 {
+			length, _ := strconv.ParseFloat(row["length"], 64)
+			fromLevel, fromOk := stopLevels[from]
+			toLevel, toOk := stopLevels[to]
+			if length > 0 {
+				time = length / PATHWAY_WALK_SPEED
+			} else if fromOk && toOk && fromLevel != toLevel {
+				time = math.Abs(fromLevel-toLevel) * PATHWAY_LEVEL_TIME
+			} else {
+				time = PATHWAY_DEFAULT_TIME
+			}
+		}
+		fromNode, toNode := node(from), node(to)
+		edges[fromNode] = append(edges[fromNode], pathwayEdge{toNode, time})
+		if row["is_bidirectional"] == "1" {
+			edges[toNode] = append(edges[toNode], pathwayEdge{fromNode, time})
+		}
+		for _, stopId := range []string{from, to} {
+			if station := stopStations[stopId]; station != nil {
+				stations[station.Id] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	platforms = make(map[string]bool)
+	stationPlatforms := make(map[string][]string)
+	for stopId, locationType := range locationTypes {
+		station := stopStations[stopId]
+		if (locationType == "" || locationType == "0") && station != nil && stations[station.Id] {
+			platforms[stopId] = true
+			stationPlatforms[station.Id] = append(stationPlatforms[station.Id], stopId)
+		}
+	}
+	stationIds := make([]string, 0, len(stationPlatforms))
+	for stationId := range stationPlatforms {
+		stationIds = append(stationIds, stationId)
+	}
+	sort.Strings(stationIds)
+
+	transfers = make([]Transfer, 0)
+	for _, stationId := range stationIds {
+		stopIds := stationPlatforms[stationId]
+		sort.Strings(stopIds)
+		for _, fromStopId := range stopIds {
+			times := pathwayTimes(edges, node(fromStopId))
+			for _, toStopId := range stopIds {
+				time, ok := times[node(toStopId)]
+				if toStopId == fromStopId || !ok {
+					continue
+				}
+				transfers = append(transfers, Transfer{fromStopId, toStopId, TRANSFER_MIN_TIME, uint32(round(time))})
+			}
+		}
+	}
+	return platforms, transfers, nil
+}
+
+// pathwayTimes returns the fastest times from source to all nodes reachable
+// through the pathways
+func pathwayTimes(edges map[int32][]pathwayEdge, source int32) map[int32]float64 {
+	times := map[int32]float64{source: 0}
+	queue := &walkQueue{{source, 0}}
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(walkQueueItem)
+		if item.distance > times[item.node] {
+			continue
+		}
+		for _, edge := range edges[item.node] {
+			time := item.distance + edge.time
+			if known, ok := times[edge.to]; ok && known <= time {
+				continue
+			}
+			times[edge.to] = time
+			heap.Push(queue, walkQueueItem{edge.to, time})
+		}
+	}
+	return times
+}
+
+// ApplyPathwayTransfers replaces the walk options between the platforms of
+// stations with pathways with in-station transfers, their TravelTime is the
+// time through the pathways
+func ApplyPathwayTransfers(path string, feed *gtfs.Feed, transfers []Transfer,
+	network *mapnificent.MapnificentNetwork,
+	stationMap map[string]uint,
+	clusters *StopClusters,
+	stopSources *StopSources,
+	options *Options) {
+	for _, transfer := range transfers {
+		fromStop, fromOk := feed.Stops[transfer.FromStopId]
+		toStop, toOk := feed.Stops[transfer.ToStopId]
+		if !fromOk || !toOk {
+			continue
+		}
+		fromIndex := GetOrCreateMapnificentStop(path, fromStop, network, stationMap, clusters, stopSources, options.ExtraInfo)
+		toIndex := GetOrCreateMapnificentStop(path, toStop, network, stationMap, clusters, stopSources, options.ExtraInfo)
+		if fromIndex == toIndex {
+			continue
+		}
+		mapnificentStop := network.Stops[fromIndex]
+		removeWalk(mapnificentStop, toIndex)
+		transferOption := new(mapnificent.MapnificentNetwork_Stop_TravelOption)
+		transferOption.Stop = uint32(toIndex)
+		transferOption.TravelTime = transfer.MinTransferTime
+		mapnificentStop.TravelOptions = append(mapnificentStop.TravelOptions, transferOption)
+	}
+}
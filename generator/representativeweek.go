@@ -0,0 +1,254 @@
+package generator
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// At most this many weeks of calendars are scanned
+const MAX_REPRESENTATIVE_WEEKS = 104
+
+// FindRepresentativeWeek scans calendar.txt and calendar_dates.txt of all
+// feeds and returns the dates (Monday first) of the week whose number of
+// trips on each weekday is closest to the typical number of trips on that
+// weekday, i.e. the median over all weeks. Holiday weeks and short
+// seasonal schedules are thereby avoided. The scanned weeks and the week
+// found are logged to logger.
+func FindRepresentativeWeek(feeds map[string]*gtfs.Feed, logger *log.Logger) ([]time.Time, error) {
+	type feedCalendar struct {
+		feed       *gtfs.Feed
+		ranges     map[string]calendarRange
+		tripCounts map[string]int
+	}
+
+	calendars := make([]feedCalendar, 0, len(feeds))
+	firstDay := math.MaxInt32
+	lastDay := 0
+	// Changes of the number of trips in service by day, to find the densest
+	// period of long calendars
+	serviceChanges := make(map[int]int)
+	for path, feed := range feeds {
+		ranges, err := readCalendarRanges(path)
+		if err != nil {
+			return nil, err
+		}
+		tripCounts := make(map[string]int)
+		for _, trip := range feed.Trips {
+			tripCounts[trip.ServiceId] += 1
+		}
+		for serviceId, r := range ranges {
+			if tripCounts[serviceId] == 0 {
+				continue
+			}
+			if r.startDate < firstDay {
+				firstDay = r.startDate
+			}
+			if r.endDate > lastDay {
+				lastDay = r.endDate
+			}
+			serviceChanges[r.startDate] += tripCounts[serviceId]
+			serviceChanges[nextDateInt(r.endDate)] -= tripCounts[serviceId]
+		}
+		for serviceId, calendardates := range feed.CalendarDates {
+			if tripCounts[serviceId] == 0 {
+				continue
+			}
+			for _, calendardate := range calendardates {
+				if calendardate.ExceptionType != 1 {
+					continue
+				}
+				if calendardate.Date < firstDay {
+					firstDay = calendardate.Date
+				}
+				if calendardate.Date > lastDay {
+					lastDay = calendardate.Date
+				}
+				serviceChanges[calendardate.Date] += tripCounts[serviceId]
+				serviceChanges[nextDateInt(calendardate.Date)] -= tripCounts[serviceId]
+			}
+		}
+		calendars = append(calendars, feedCalendar{feed, ranges, tripCounts})
+	}
+	if lastDay == 0 {
+		return nil, errors.New("no service found in calendar.txt or calendar_dates.txt")
+	}
+
+	first, err := parseDateInt(firstDay)
+	if err != nil {
+		return nil, err
+	}
+	last, err := parseDateInt(lastDay)
+	if err != nil {
+		return nil, err
+	}
+	// Start on the Monday of the first week
+	first = startOfWeek(first)
+	days := int(last.Sub(first).Hours()/24) + 1
+	weeks := (days + 6) / 7
+	if weeks > MAX_REPRESENTATIVE_WEEKS {
+		// A long-lived calendar must not push the scan away from the
+		// current timetable, only scan the period in which at least half of
+		// the most trips ever in service run
+		start, end, err := densestServicePeriod(serviceChanges)
+		if err != nil {
+			return nil, err
+		}
+		if start.After(first) {
+			first = startOfWeek(start)
+		}
+		if end.Before(last) {
+			last = end
+		}
+		days = int(last.Sub(first).Hours()/24) + 1
+		weeks = (days + 6) / 7
+		if weeks > MAX_REPRESENTATIVE_WEEKS {
+			weeks = MAX_REPRESENTATIVE_WEEKS
+		}
+		logger.Println("Scanning", weeks, "weeks from", first.Format("2006-01-02"), "for the representative week")
+	}
+
+	// Number of trips running on every day of the scanned weeks
+	dayTrips := make([]int, weeks*7)
+	for _, calendar := range calendars {
+		for serviceId, trips := range calendar.tripCounts {
+			r, hasRange := calendar.ranges[serviceId]
+			exceptions := make(map[int]int)
+			for _, calendardate := range calendar.feed.CalendarDates[serviceId] {
+				exceptions[calendardate.Date] = int(calendardate.ExceptionType)
+			}
+			if !hasRange && len(exceptions) == 0 {
+				continue
+			}
+			for i := range dayTrips {
+				date := first.AddDate(0, 0, i)
+				day := dateToInt(date)
+				active := hasRange && day >= r.startDate && day <= r.endDate && r.weekdays&weekdayBit(date.Weekday()) != 0
+				if exceptionType, ok := exceptions[day]; ok {
+					active = exceptionType == 1
+				}
+				if active {
+					dayTrips[i] += trips
+				}
+			}
+		}
+	}
+
+	activeWeeks := make([]int, 0, weeks)
+	for week := 0; week < weeks; week++ {
+		total := 0
+		for _, trips := range dayTrips[week*7 : week*7+7] {
+			total += trips
+		}
+		if total > 0 {
+			activeWeeks = append(activeWeeks, week)
+		}
+	}
+
+	if len(activeWeeks) == 0 {
+		return nil, errors.New("no trips in service in any week of calendar.txt or calendar_dates.txt")
+	}
+
+	// Typical number of trips for every weekday
+	typical := make([]float64, 7)
+	for weekday := range typical {
+		counts := make([]int, 0, len(activeWeeks))
+		for _, week := range activeWeeks {
+			counts = append(counts, dayTrips[week*7+weekday])
+		}
+		sort.Ints(counts)
+		middle := len(counts) / 2
+		if len(counts)%2 == 0 {
+			typical[weekday] = float64(counts[middle-1]+counts[middle]) / 2
+		} else {
+			typical[weekday] = float64(counts[middle])
+		}
+	}
+
+	bestWeek := -1
+	bestScore := math.Inf(1)
+	bestTotal := 0
+	for _, week := range activeWeeks {
+		score := 0.0
+		total := 0
+		for weekday := 0; weekday < 7; weekday++ {
+			trips := dayTrips[week*7+weekday]
+			score += math.Abs(float64(trips) - typical[weekday])
+			total += trips
+		}
+		// Prefer more service among equally typical weeks
+		if score < bestScore || (score == bestScore && total > bestTotal) {
+			bestWeek = week
+			bestScore = score
+			bestTotal = total
+		}
+	}
+
+	dates := make([]time.Time, 7)
+	for weekday := range dates {
+		dates[weekday] = first.AddDate(0, 0, bestWeek*7+weekday)
+	}
+	logger.Println("Representative week starts", dates[0].Format("2006-01-02"), "with", bestTotal, "trips")
+	return dates, nil
+}
+
+// densestServicePeriod returns the first and last day on which at least
+// half of the most trips ever in service run, from the changes of the
+// number of trips in service by day
+func densestServicePeriod(changes map[int]int) (time.Time, time.Time, error) {
+	days := make([]int, 0, len(changes))
+	for day := range changes {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	most, trips := 0, 0
+	for _, day := range days {
+		trips += changes[day]
+		if trips > most {
+			most = trips
+		}
+	}
+	startDay, endDay := 0, 0
+	trips = 0
+	for i, day := range days {
+		trips += changes[day]
+		if 2*trips < most {
+			continue
+		}
+		if startDay == 0 {
+			startDay = day
+		}
+		if i+1 < len(days) {
+			// Up to the day before the next change
+			endDay = days[i+1]
+		}
+	}
+	start, err := parseDateInt(startDay)
+	if err != nil {
+		return start, start, err
+	}
+	end, err := parseDateInt(endDay)
+	if err != nil {
+		return start, end, err
+	}
+	return start, end.AddDate(0, 0, -1), nil
+}
+
+// startOfWeek returns the Monday of the week of date
+func startOfWeek(date time.Time) time.Time {
+	return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+}
+
+// nextDateInt returns the GTFS integer date after day, an invalid day is
+// returned as is
+func nextDateInt(day int) int {
+	date, err := parseDateInt(day)
+	if err != nil {
+		return day
+	}
+	return dateToInt(date.AddDate(0, 0, 1))
+}
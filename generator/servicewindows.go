@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ServiceWindow describes a time span on a set of weekdays for which
+// line frequencies are computed.
+// Weekdays is a bitmask: 7 bits, Monday lowest bit
+// 31 Weekdays
+// 96 Weekends
+// 64 Sunday
+// 63 all but Sunday
+// 32 Saturday
+// 48 Friday/Saturday
+type ServiceWindow struct {
+	Weekdays int32 `json:"weekdays"`
+	Start    int32 `json:"start"`
+	Duration int32 `json:"duration"`
+}
+
+// These are the service windows used if nothing else is configured
+var defaultServiceWindows = []ServiceWindow{
+	{Weekdays: 1, Start: 6, Duration: HOUR_RANGE},   // Monday from 6
+	{Weekdays: 48, Start: 21, Duration: HOUR_RANGE}, // Friday Saturday evening
+}
+
+func (w ServiceWindow) End() int32 {
+	return w.Start + w.Duration
+}
+
+// ContainsHour reports whether a departure in hour falls into the window,
+// the window ends before its End hour
+func (w ServiceWindow) ContainsHour(hour int32) bool {
+	return hour >= w.Start && hour < w.End()
+}
+
+func (w ServiceWindow) validate() error {
+	if w.Weekdays <= 0 || w.Weekdays > 127 {
+		return fmt.Errorf("weekdays bitmask %d out of range 1-127", w.Weekdays)
+	}
+	// GTFS times may go beyond 24:00 for trips after midnight
+	if w.Start < 0 || w.Start > 47 {
+		return fmt.Errorf("start hour %d out of range 0-47", w.Start)
+	}
+	if w.Duration <= 0 {
+		return fmt.Errorf("duration %d must be positive", w.Duration)
+	}
+	return nil
+}
+
+// ParseServiceWindows parses a list of windows like "1:6:3,48:21:3"
+// (weekdays:start:duration), duration defaults to HOUR_RANGE.
+func ParseServiceWindows(s string) ([]ServiceWindow, error) {
+	windows := make([]ServiceWindow, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid service window %q, expected weekdays:start[:duration]", part)
+		}
+		values := []int32{0, 0, HOUR_RANGE}
+		for i, field := range fields {
+			v, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid service window %q: %v", part, err)
+			}
+			values[i] = int32(v)
+		}
+		window := ServiceWindow{Weekdays: values[0], Start: values[1], Duration: values[2]}
+		if err := window.validate(); err != nil {
+			return nil, fmt.Errorf("invalid service window %q: %v", part, err)
+		}
+		windows = append(windows, window)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no service windows in %q", s)
+	}
+	return windows, nil
+}
@@ -0,0 +1,29 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+func TestServiceWindowContainsHour(t *testing.T) {
+	window := ServiceWindow{Weekdays: 1, Start: 7, Duration: 2}
+	for hour, want := range map[int32]bool{6: false, 7: true, 8: true, 9: false} {
+		if got := window.ContainsHour(hour); got != want {
+			t.Errorf("hour %d: got %v, want %v", hour, got, want)
+		}
+	}
+}
+
+func TestTripDeparturesWindowOverlap(t *testing.T) {
+	window := ServiceWindow{Weekdays: 1, Start: 6, Duration: 3}
+	// Every 10 minutes all day, the window overlaps 3 hours of it
+	trip := &gtfs.Trip{Id: "T", Frequencies: []*gtfs.Frequency{{StartTime: 0, EndTime: 24 * 3600, HeadwaySecs: 600}}}
+	if departures := GetTripDepartures(trip, window, FrequencyExactTimes{}); len(departures) != 18 {
+		t.Errorf("got %d departures, want 18", len(departures))
+	}
+	departures := GetTripDepartures(trip, window, FrequencyExactTimes{frequencyKey("T", 0): true})
+	if len(departures) != 18 || departures[0] != 6*3600 || departures[17] != 9*3600-600 {
+		t.Errorf("got exact departures %v, want 6:00 to 8:50", departures)
+	}
+}
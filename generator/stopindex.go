@@ -0,0 +1,120 @@
+package generator
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// IndexedStop is a stop of one of the feeds
+type IndexedStop struct {
+	Path string
+	Stop *gtfs.Stop
+}
+
+// IndexedStopDistance is a stop found near a coordinate
+type IndexedStopDistance struct {
+	IndexedStop
+	Distance float64
+	index    int
+}
+
+// StopIndex finds the stops of all feeds near a coordinate, it is built
+// once instead of searching every feed for every stop
+type StopIndex struct {
+	Stops  []IndexedStop
+	radius float64
+	grid   *gridIndex
+}
+
+// NewStopIndex indexes the stops of all feeds sorted by feed id and stop
+// id for searches up to radius meters
+func NewStopIndex(feeds map[string]*gtfs.Feed, ids FeedIds, radius float64) *StopIndex {
+	index := &StopIndex{
+		Stops:  make([]IndexedStop, 0),
+		radius: radius,
+		grid:   newGridIndex(GetStopsBoundingBox(feeds), radius),
+	}
+	for _, path := range sortedFeedPaths(feeds, ids) {
+		feed := feeds[path]
+		for _, stopId := range sortedStopIds(feed) {
+			stop := feed.Stops[stopId]
+			index.grid.Add(stop.Lat, stop.Lon, len(index.Stops))
+			index.Stops = append(index.Stops, IndexedStop{path, stop})
+		}
+	}
+	return index
+}
+
+// Within returns the stops within radius meters of a coordinate sorted by
+// distance, stops at the same distance in index order. A radius beyond the
+// radius of the index searches more cells.
+func (idx *StopIndex) Within(lat float64, lon float64, radius float64) []IndexedStopDistance {
+	rings := int(math.Ceil(radius / idx.radius))
+	if rings < 1 {
+		rings = 1
+	}
+	found := make([]int, 0)
+	distances := make(map[int]float64)
+	idx.grid.Nearby(lat, lon, rings, func(i int) {
+		stop := idx.Stops[i].Stop
+		distance := haversine(lat, lon, stop.Lat, stop.Lon)
+		if distance <= radius {
+			found = append(found, i)
+			distances[i] = distance
+		}
+	})
+	sort.Slice(found, func(a, b int) bool {
+		if distances[found[a]] != distances[found[b]] {
+			return distances[found[a]] < distances[found[b]]
+		}
+		return found[a] < found[b]
+	})
+	stopDistances := make([]IndexedStopDistance, len(found))
+	for j, i := range found {
+		stopDistances[j] = IndexedStopDistance{idx.Stops[i], distances[i], i}
+	}
+	return stopDistances
+}
+
+// gridIndex finds points near a coordinate by bucketing them into cells
+// of at least cellSize meters
+type gridIndex struct {
+	cellLat float64
+	cellLon float64
+	cells   map[[2]int][]int
+}
+
+func newGridIndex(bbox BoundingBox, cellSize float64) *gridIndex {
+	cellLat := cellSize / EARTH_RADIUS * 180 / math.Pi
+	maxLat := math.Min(math.Max(math.Abs(bbox.MinLat), math.Abs(bbox.MaxLat)), 89)
+	return &gridIndex{
+		cellLat: cellLat,
+		cellLon: cellLat / math.Cos(maxLat*math.Pi/180),
+		cells:   make(map[[2]int][]int),
+	}
+}
+
+func (g *gridIndex) cell(lat float64, lon float64) [2]int {
+	return [2]int{int(math.Floor(lat / g.cellLat)), int(math.Floor(lon / g.cellLon))}
+}
+
+func (g *gridIndex) Add(lat float64, lon float64, i int) {
+	c := g.cell(lat, lon)
+	g.cells[c] = append(g.cells[c], i)
+}
+
+// Nearby calls fn for all points in the cell of the coordinate and the
+// rings of cells around it, which includes all points within rings times
+// cellSize
+func (g *gridIndex) Nearby(lat float64, lon float64, rings int, fn func(i int)) {
+	c := g.cell(lat, lon)
+	for dLat := -rings; dLat <= rings; dLat++ {
+		for dLon := -rings; dLon <= rings; dLon++ {
+			for _, i := range g.cells[[2]int{c[0] + dLat, c[1] + dLon}] {
+				fn(i)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// randomFeeds creates feeds with stops spread randomly over a city sized
+// area
+func randomFeeds(feedCount int, stopCount int) map[string]*gtfs.Feed {
+	rng := rand.New(rand.NewSource(1))
+	feeds := make(map[string]*gtfs.Feed)
+	for f := 0; f < feedCount; f++ {
+		feed := &gtfs.Feed{Stops: make(map[string]*gtfs.Stop)}
+		for i := 0; i < stopCount; i++ {
+			stop := &gtfs.Stop{Id: fmt.Sprint(i), Lat: 52.3 + rng.Float64()*0.4, Lon: 13.1 + rng.Float64()*0.6}
+			feed.Stops[stop.Id] = stop
+			feed.StopCollection.Stops = append(feed.StopCollection.Stops, stop)
+		}
+		feeds[fmt.Sprintf("/feeds/%d", f)] = feed
+	}
+	return feeds
+}
+
+// linearWithin searches every feed for stops near a coordinate, as done
+// before the stop index
+func linearWithin(feeds map[string]*gtfs.Feed, lat float64, lon float64, radius float64) []string {
+	found := make([]string, 0)
+	for path, feed := range feeds {
+		for _, stopDistance := range feed.StopCollection.StopDistancesByProximity(lat, lon, radius) {
+			if haversine(lat, lon, stopDistance.Stop.Lat, stopDistance.Stop.Lon) <= radius {
+				found = append(found, path+"|"+stopDistance.Stop.Id)
+			}
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+func indexWithin(index *StopIndex, lat float64, lon float64, radius float64) []string {
+	found := make([]string, 0)
+	for _, stopDistance := range index.Within(lat, lon, radius) {
+		found = append(found, stopDistance.Path+"|"+stopDistance.Stop.Id)
+	}
+	sort.Strings(found)
+	return found
+}
+
+func TestStopIndexWithin(t *testing.T) {
+	feeds := randomFeeds(4, 1000)
+	index := NewStopIndex(feeds, nil, 350)
+	// Radii below, at and beyond the radius of the index
+	for _, radius := range []float64{100, 350, 1000} {
+		for _, stop := range index.Stops[:200] {
+			want := linearWithin(feeds, stop.Stop.Lat, stop.Stop.Lon, radius)
+			got := indexWithin(index, stop.Stop.Lat, stop.Stop.Lon, radius)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("radius %g around %s: got %v, want %v", radius, stop.Stop.Id, got, want)
+			}
+		}
+	}
+}
+
+func TestStopIndexWithinSorted(t *testing.T) {
+	feeds := randomFeeds(2, 1000)
+	index := NewStopIndex(feeds, nil, 500)
+	stop := index.Stops[0].Stop
+	found := index.Within(stop.Lat, stop.Lon, 500)
+	if len(found) == 0 || found[0].Stop != stop || found[0].Distance != 0 {
+		t.Fatalf("expected the stop itself first, got %v", found)
+	}
+	for i := 1; i < len(found); i++ {
+		if found[i].Distance < found[i-1].Distance {
+			t.Fatalf("stops not sorted by distance at %d", i)
+		}
+	}
+}
+
+func BenchmarkStopIndexWithin(b *testing.B) {
+	feeds := randomFeeds(10, 2000)
+	index := NewStopIndex(feeds, nil, 350)
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			stop := index.Stops[i%len(index.Stops)].Stop
+			index.Within(stop.Lat, stop.Lon, 350)
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			stop := index.Stops[i%len(index.Stops)].Stop
+			for _, feed := range feeds {
+				feed.StopCollection.StopDistancesByProximity(stop.Lat, stop.Lon, 350)
+			}
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"strconv"
+)
+
+// StopMerging selects how GTFS stops are merged into Mapnificent stops
+type StopMerging string
+
+const (
+	// Merge all stops within the merge radius
+	MERGE_RADIUS StopMerging = "radius"
+	// Merge stops of the same parent_station, only stops without a
+	// station are merged within the merge radius
+	MERGE_STATION StopMerging = "station"
+)
+
+// StopStation is the top-level station (location_type 1) of a stop
+type StopStation struct {
+	Id   string
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// StopHierarchy maps feed path and stop id to the station of the stop,
+// stops without a station are missing
+type StopHierarchy map[string]map[string]*StopStation
+
+// GetStation returns the station of a stop or nil for orphan stops
+func (h StopHierarchy) GetStation(path string, stopId string) *StopStation {
+	return h[path][stopId]
+}
+
+// readStopStations resolves the parent_station hierarchy of stops.txt
+// of the feed at path to the top-level station of every stop
+func readStopStations(path string) (map[string]*StopStation, error) {
+	parents := make(map[string]string)
+	stations := make(map[string]*StopStation)
+	_, err := readGtfsCsv(path, "stops.txt", func(row map[string]string) error {
+		stopId := row["stop_id"]
+		if row["parent_station"] != "" {
+			parents[stopId] = row["parent_station"]
+		}
+		if row["location_type"] == "1" {
+			lat, _ := strconv.ParseFloat(row["stop_lat"], 64)
+			lon, _ := strconv.ParseFloat(row["stop_lon"], 64)
+			stations[stopId] = &StopStation{stopId, row["stop_name"], lat, lon}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stopStations := make(map[string]*StopStation)
+	for stopId := range parents {
+		// Boarding areas have platforms as parents, follow up to the top
+		current := stopId
+		for i := 0; i < 5; i++ {
+			parent, ok := parents[current]
+			if !ok {
+				break
+			}
+			current = parent
+		}
+		if station, ok := stations[current]; ok {
+			stopStations[stopId] = station
+		}
+	}
+	for stopId, station := range stations {
+		if _, ok := parents[stopId]; !ok {
+			stopStations[stopId] = station
+		}
+	}
+	return stopStations, nil
+}
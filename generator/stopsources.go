@@ -0,0 +1,43 @@
+package generator
+
+import (
+	"github.com/mapnificent/gogtfs"
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+// StopSources holds what describes the GTFS stops merged into Mapnificent
+// stops besides the stops themselves
+type StopSources struct {
+	FeedIds FeedIds
+	// Feed path and stop id to the stop_code of stops.txt, stops without a
+	// code are missing
+	Codes map[string]map[string]string
+}
+
+// GetCode returns the code of a stop or an empty string
+func (s *StopSources) GetCode(path string, stopId string) string {
+	return s.Codes[path][stopId]
+}
+
+// readStopCodes reads the stop_code column of stops.txt of the feed at path
+func readStopCodes(path string) (map[string]string, error) {
+	stopCodes := make(map[string]string)
+	_, err := readGtfsCsv(path, "stops.txt", func(row map[string]string) error {
+		if row["stop_code"] != "" {
+			stopCodes[row["stop_id"]] = row["stop_code"]
+		}
+		return nil
+	})
+	return stopCodes, err
+}
+
+// NewStopSource describes a GTFS stop merged into a Mapnificent stop, the
+// feed by its unique id
+func (s *StopSources) NewStopSource(path string, stop *gtfs.Stop) *mapnificent.MapnificentNetwork_Stop_Source {
+	return &mapnificent.MapnificentNetwork_Stop_Source{
+		FeedId:   s.FeedIds.Id(path),
+		StopId:   stop.Id,
+		StopName: stop.Name,
+		StopCode: s.GetCode(path, stop.Id),
+	}
+}
@@ -0,0 +1,313 @@
+package generator
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// StreamedStopTimes holds the stop times of a feed read in streaming mode.
+// Trips with the same stops share one pattern and trips with the same times
+// relative to their first departure share one profile, so memory grows with
+// the number of trips and distinct schedules instead of the number of stop
+// times. Until they are materialized the StopTimes of a trip are the shared
+// pattern without times.
+type StreamedStopTimes struct {
+	patterns     [][]gtfs.StopTime
+	profiles     [][]uint32
+	patternIndex map[string]int32
+	profileIndex map[string]int32
+	trips        map[string]streamedTrip
+}
+
+type streamedTrip struct {
+	pattern int32
+	profile int32
+	start   uint
+}
+
+// StopTimeStreams maps feed path to the stop times of streamed feeds,
+// feeds loaded in full are missing
+type StopTimeStreams map[string]*StreamedStopTimes
+
+// Materialize gives the trips of the feed at path their full stop times
+func (s StopTimeStreams) Materialize(path string, trips *list.List) {
+	streamed := s[path]
+	if streamed == nil {
+		return
+	}
+	for e := trips.Front(); e != nil; e = e.Next() {
+		trip := e.Value.(*gtfs.Trip)
+		st, ok := streamed.trips[trip.Id]
+		if !ok {
+			continue
+		}
+		pattern := streamed.patterns[st.pattern]
+		profile := streamed.profiles[st.profile]
+		stopTimes := make([]gtfs.StopTime, len(pattern))
+		for i := range pattern {
+			stopTimes[i].Stop = pattern[i].Stop
+			stopTimes[i].ArrivalTime = st.start + uint(profile[2*i])
+			stopTimes[i].DepartureTime = st.start + uint(profile[2*i+1])
+		}
+		trip.StopTimes = stopTimes
+	}
+}
+
+// Release sets the stop times of the trips back to their shared pattern
+func (s StopTimeStreams) Release(path string, trips *list.List) {
+	streamed := s[path]
+	if streamed == nil {
+		return
+	}
+	for e := trips.Front(); e != nil; e = e.Next() {
+		trip := e.Value.(*gtfs.Trip)
+		if st, ok := streamed.trips[trip.Id]; ok {
+			trip.StopTimes = streamed.patterns[st.pattern]
+		}
+	}
+}
+
+type streamedStopTime struct {
+	sequence  int
+	stop      *gtfs.Stop
+	arrival   uint
+	departure uint
+	timed     bool
+}
+
+// add stores the stop times of trip, sorted by stop_sequence and with
+// missing times interpolated between the timed stops around them
+func (s *StreamedStopTimes) add(trip *gtfs.Trip, stopTimes []streamedStopTime) {
+	sort.SliceStable(stopTimes, func(i, j int) bool {
+		return stopTimes[i].sequence < stopTimes[j].sequence
+	})
+	first, last := -1, -1
+	for i := range stopTimes {
+		if !stopTimes[i].timed {
+			continue
+		}
+		if last >= 0 && i-last > 1 {
+			from, to := stopTimes[last].departure, stopTimes[i].arrival
+			if to < from {
+				to = from
+			}
+			for j := last + 1; j < i; j++ {
+				t := from + (to-from)*uint(j-last)/uint(i-last)
+				stopTimes[j].arrival, stopTimes[j].departure = t, t
+			}
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 {
+		// No times at all
+		return
+	}
+	// Untimed stops before the first or after the last timed stop
+	for i := 0; i < first; i++ {
+		stopTimes[i].arrival, stopTimes[i].departure = stopTimes[first].arrival, stopTimes[first].arrival
+	}
+	for i := last + 1; i < len(stopTimes); i++ {
+		stopTimes[i].arrival, stopTimes[i].departure = stopTimes[last].departure, stopTimes[last].departure
+	}
+
+	var patternKey strings.Builder
+	for _, stopTime := range stopTimes {
+		patternKey.WriteString(stopTime.stop.Id)
+		patternKey.WriteString("\x00")
+	}
+	pattern, ok := s.patternIndex[patternKey.String()]
+	if !ok {
+		stops := make([]gtfs.StopTime, len(stopTimes))
+		for i, stopTime := range stopTimes {
+			stops[i].Stop = stopTime.stop
+		}
+		pattern = int32(len(s.patterns))
+		s.patterns = append(s.patterns, stops)
+		s.patternIndex[patternKey.String()] = pattern
+	}
+
+	start := stopTimes[0].departure
+	if stopTimes[0].arrival < start {
+		start = stopTimes[0].arrival
+	}
+	offsets := make([]uint32, 2*len(stopTimes))
+	profileKey := make([]byte, 0, 4*len(stopTimes))
+	for i, stopTime := range stopTimes {
+		if stopTime.arrival < start || stopTime.departure < start {
+			// Times going backwards, keep them at the start
+			stopTime.arrival, stopTime.departure = start, start
+		}
+		offsets[2*i] = uint32(stopTime.arrival - start)
+		offsets[2*i+1] = uint32(stopTime.departure - start)
+		profileKey = binary.AppendUvarint(profileKey, uint64(offsets[2*i]))
+		profileKey = binary.AppendUvarint(profileKey, uint64(offsets[2*i+1]))
+	}
+	profile, ok := s.profileIndex[string(profileKey)]
+	if !ok {
+		profile = int32(len(s.profiles))
+		s.profiles = append(s.profiles, offsets)
+		s.profileIndex[string(profileKey)] = profile
+	}
+
+	s.trips[trip.Id] = streamedTrip{pattern, profile, start}
+	trip.StopTimes = s.patterns[pattern]
+}
+
+// LoadStreamedFeed reads the feed at path without holding all stop times
+// in memory. stop_times.txt is read in a single pass and has to be grouped
+// by trip_id, as most feeds are.
+//
+// Only the fields the generator uses are filled: id, name and position of
+// stops, id and names of routes, id, route, service, headsign, direction
+// and frequencies of trips, the weekdays of calendar.txt and all of
+// calendar_dates.txt. Other fields of the gtfs types stay empty. Date
+// ranges of calendar.txt, stop codes, parent stations, exact_times and
+// transfers are read from the feed files by the generator itself for
+// streamed and fully loaded feeds alike, so no option depends on them.
+func LoadStreamedFeed(path string) (*gtfs.Feed, *StreamedStopTimes, error) {
+	feed := &gtfs.Feed{
+		Stops:         make(map[string]*gtfs.Stop),
+		Routes:        make(map[string]*gtfs.Route),
+		Trips:         make(map[string]*gtfs.Trip),
+		Calendars:     make(map[string]*gtfs.Calendar),
+		CalendarDates: make(map[string][]*gtfs.CalendarDate),
+	}
+	_, err := readGtfsCsv(path, "stops.txt", func(row map[string]string) error {
+		lat, _ := strconv.ParseFloat(row["stop_lat"], 64)
+		lon, _ := strconv.ParseFloat(row["stop_lon"], 64)
+		feed.Stops[row["stop_id"]] = &gtfs.Stop{Id: row["stop_id"], Name: row["stop_name"], Lat: lat, Lon: lon}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = readGtfsCsv(path, "routes.txt", func(row map[string]string) error {
+		feed.Routes[row["route_id"]] = &gtfs.Route{Id: row["route_id"], ShortName: row["route_short_name"], LongName: row["route_long_name"]}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = readGtfsCsv(path, "trips.txt", func(row map[string]string) error {
+		trip := &gtfs.Trip{Id: row["trip_id"], Route: feed.Routes[row["route_id"]], ServiceId: row["service_id"], Headsign: row["trip_headsign"]}
+		if direction, err := strconv.Atoi(row["direction_id"]); err == nil {
+			trip.Direction = byte(direction)
+			trip.HasDirection = true
+		}
+		feed.Trips[trip.Id] = trip
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = readGtfsCsv(path, "calendar.txt", func(row map[string]string) error {
+		feed.Calendars[row["service_id"]] = &gtfs.Calendar{
+			ServiceId: row["service_id"],
+			Monday:    row["monday"] == "1",
+			Tuesday:   row["tuesday"] == "1",
+			Wednesday: row["wednesday"] == "1",
+			Thursday:  row["thursday"] == "1",
+			Friday:    row["friday"] == "1",
+			Saturday:  row["saturday"] == "1",
+			Sunday:    row["sunday"] == "1",
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = readGtfsCsv(path, "calendar_dates.txt", func(row map[string]string) error {
+		date, err := strconv.Atoi(row["date"])
+		if err != nil {
+			return fmt.Errorf("invalid date %q", row["date"])
+		}
+		exceptionType, _ := strconv.Atoi(row["exception_type"])
+		serviceId := row["service_id"]
+		feed.CalendarDates[serviceId] = append(feed.CalendarDates[serviceId], &gtfs.CalendarDate{ServiceId: serviceId, Date: date, ExceptionType: exceptionType})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = readGtfsCsv(path, "frequencies.txt", func(row map[string]string) error {
+		trip, ok := feed.Trips[row["trip_id"]]
+		if !ok {
+			return nil
+		}
+		startTime, err := parseGtfsTime(row["start_time"])
+		if err != nil {
+			return err
+		}
+		endTime, err := parseGtfsTime(row["end_time"])
+		if err != nil {
+			return err
+		}
+		headway, _ := strconv.ParseUint(row["headway_secs"], 10, 32)
+		trip.Frequencies = append(trip.Frequencies, &gtfs.Frequency{StartTime: startTime, EndTime: endTime, HeadwaySecs: uint(headway)})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	streamed := &StreamedStopTimes{
+		patternIndex: make(map[string]int32),
+		profileIndex: make(map[string]int32),
+		trips:        make(map[string]streamedTrip),
+	}
+	var currentTrip *gtfs.Trip
+	currentTripId := ""
+	stopTimes := make([]streamedStopTime, 0)
+	done := make(map[string]bool)
+	flush := func() {
+		if currentTrip != nil {
+			streamed.add(currentTrip, stopTimes)
+		}
+		done[currentTripId] = true
+		stopTimes = stopTimes[:0]
+	}
+	_, err = readGtfsCsv(path, "stop_times.txt", func(row map[string]string) error {
+		feed.StopTimesCount += 1
+		tripId := row["trip_id"]
+		if tripId != currentTripId {
+			flush()
+			if done[tripId] {
+				return fmt.Errorf("trip %q is not in one block, streaming needs stop_times.txt grouped by trip_id", tripId)
+			}
+			currentTripId = tripId
+			currentTrip = feed.Trips[tripId]
+		}
+		stop, ok := feed.Stops[row["stop_id"]]
+		if !ok || currentTrip == nil {
+			return nil
+		}
+		sequence, _ := strconv.Atoi(row["stop_sequence"])
+		stopTime := streamedStopTime{sequence: sequence, stop: stop}
+		arrival, arrivalErr := parseGtfsTime(row["arrival_time"])
+		departure, departureErr := parseGtfsTime(row["departure_time"])
+		switch {
+		case arrivalErr == nil && departureErr == nil:
+			stopTime.arrival, stopTime.departure, stopTime.timed = arrival, departure, true
+		case arrivalErr == nil:
+			stopTime.arrival, stopTime.departure, stopTime.timed = arrival, arrival, true
+		case departureErr == nil:
+			stopTime.arrival, stopTime.departure, stopTime.timed = departure, departure, true
+		}
+		stopTimes = append(stopTimes, stopTime)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	flush()
+	return feed, streamed, nil
+}
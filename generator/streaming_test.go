@@ -0,0 +1,239 @@
+package generator
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+	"time"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+func writeTestFile(t testing.TB, dir string, name string, content string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func formatGtfsTime(seconds uint) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// writeSyntheticFeed writes a feed with routes lines of tripsPerRoute
+// trips serving stopsPerTrip stops each. Every third stop of a trip has
+// no times.
+func writeSyntheticFeed(t testing.TB, dir string, routes int, tripsPerRoute int, stopsPerTrip int) {
+	writeTestFile(t, dir, "calendar.txt", "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\nS,1,1,1,1,1,1,1,20260101,20261231\n")
+	stopCount := routes * 5
+	stops, err := os.Create(filepath.Join(dir, "stops.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stops.Close()
+	fmt.Fprintln(stops, "stop_id,stop_name,stop_lat,stop_lon")
+	for i := 0; i < stopCount; i++ {
+		fmt.Fprintf(stops, "s%d,Stop %d,%f,%f\n", i, i, 52+float64(i%70)*0.005, 13+float64(i/70)*0.008)
+	}
+
+	routeFile, err := os.Create(filepath.Join(dir, "routes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer routeFile.Close()
+	tripFile, err := os.Create(filepath.Join(dir, "trips.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tripFile.Close()
+	stopTimeFile, err := os.Create(filepath.Join(dir, "stop_times.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopTimeFile.Close()
+	tripWriter := bufio.NewWriter(tripFile)
+	stopTimeWriter := bufio.NewWriter(stopTimeFile)
+	fmt.Fprintln(routeFile, "route_id,route_short_name")
+	fmt.Fprintln(tripWriter, "route_id,service_id,trip_id,trip_headsign")
+	fmt.Fprintln(stopTimeWriter, "trip_id,arrival_time,departure_time,stop_id,stop_sequence")
+	for r := 0; r < routes; r++ {
+		fmt.Fprintf(routeFile, "R%d,%d\n", r, r)
+		for k := 0; k < tripsPerRoute; k++ {
+			tripId := fmt.Sprintf("t%d_%d", r, k)
+			fmt.Fprintf(tripWriter, "R%d,S,%s,H%d\n", r, tripId, k%2)
+			departure := uint(5*3600 + k*150)
+			for j := 0; j < stopsPerTrip; j++ {
+				stop := (r*37 + j*(1+k%2)) % stopCount
+				arrivalTime := formatGtfsTime(departure + uint(j*90))
+				departureTime := formatGtfsTime(departure + uint(j*90+20))
+				if j%3 == 1 && j < stopsPerTrip-1 {
+					arrivalTime, departureTime = "", ""
+				}
+				fmt.Fprintf(stopTimeWriter, "%s,%s,%s,s%d,%d\n", tripId, arrivalTime, departureTime, stop, j)
+			}
+		}
+	}
+	if err := tripWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stopTimeWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamedStopTimesMaterialize(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "calendar.txt", "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\nS,1,1,1,1,1,0,0,20260101,20261231\n")
+	writeTestFile(t, dir, "stops.txt", "stop_id,stop_name,stop_lat,stop_lon\nA,A,52.0,13.0\nB,B,52.01,13.0\nC,C,52.02,13.0\nD,D,52.03,13.0\n")
+	writeTestFile(t, dir, "routes.txt", "route_id,route_short_name\nR,1\n")
+	writeTestFile(t, dir, "trips.txt", "route_id,service_id,trip_id\nR,S,t1\nR,S,t2\nR,S,t3\n")
+	// t1 and t2 share pattern and profile, t3 is given out of order and
+	// has untimed stops in the middle and at the end
+	writeTestFile(t, dir, "stop_times.txt", "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n"+
+		"t1,05:00:00,05:00:30,A,1\nt1,05:02:00,05:02:30,B,2\nt1,05:05:00,05:05:00,C,3\n"+
+		"t2,06:00:00,06:00:30,A,1\nt2,06:02:00,06:02:30,B,2\nt2,06:05:00,06:05:00,C,3\n"+
+		"t3,07:10:00,07:10:00,D,4\nt3,,,C,3\nt3,07:00:00,07:01:00,A,1\nt3,,,B,2\nt3,,,A,5\n")
+
+	feed, streamed, err := LoadStreamedFeed(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.StopTimesCount != 11 {
+		t.Errorf("got %d stop times, want 11", feed.StopTimesCount)
+	}
+	if len(streamed.patterns) != 2 || len(streamed.profiles) != 2 {
+		t.Errorf("got %d patterns and %d profiles, want 2 each", len(streamed.patterns), len(streamed.profiles))
+	}
+
+	want := map[string][][3]interface{}{
+		"t1": {{"A", 5*3600 + 0, 5*3600 + 30}, {"B", 5*3600 + 120, 5*3600 + 150}, {"C", 5*3600 + 300, 5*3600 + 300}},
+		"t2": {{"A", 6*3600 + 0, 6*3600 + 30}, {"B", 6*3600 + 120, 6*3600 + 150}, {"C", 6*3600 + 300, 6*3600 + 300}},
+		// B and C interpolated between 07:01:00 and 07:10:00, the last
+		// stop takes the time of the last timed stop
+		"t3": {{"A", 7 * 3600, 7*3600 + 60}, {"B", 7*3600 + 240, 7*3600 + 240}, {"C", 7*3600 + 420, 7*3600 + 420}, {"D", 7*3600 + 600, 7*3600 + 600}, {"A", 7*3600 + 600, 7*3600 + 600}},
+	}
+	trips := list.New()
+	for _, tripId := range []string{"t1", "t2", "t3"} {
+		trips.PushBack(feed.Trips[tripId])
+	}
+	streams := StopTimeStreams{dir: streamed}
+	streams.Materialize(dir, trips)
+	for tripId, stopTimes := range want {
+		trip := feed.Trips[tripId]
+		if len(trip.StopTimes) != len(stopTimes) {
+			t.Fatalf("%s: got %d stop times, want %d", tripId, len(trip.StopTimes), len(stopTimes))
+		}
+		for i, stopTime := range stopTimes {
+			got := [3]interface{}{trip.StopTimes[i].Stop.Id, int(trip.StopTimes[i].ArrivalTime), int(trip.StopTimes[i].DepartureTime)}
+			if got != stopTime {
+				t.Errorf("%s stop %d: got %v, want %v", tripId, i, got, stopTime)
+			}
+		}
+	}
+
+	streams.Release(dir, trips)
+	for _, tripId := range []string{"t1", "t2"} {
+		stopTimes := feed.Trips[tripId].StopTimes
+		if len(stopTimes) != 3 || stopTimes[1].ArrivalTime != 0 {
+			t.Errorf("%s: expected the shared pattern without times after release, got %v", tripId, stopTimes)
+		}
+	}
+}
+
+func TestLoadStreamedFeedUngrouped(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "stops.txt", "stop_id,stop_name,stop_lat,stop_lon\nA,A,52.0,13.0\nB,B,52.01,13.0\n")
+	writeTestFile(t, dir, "routes.txt", "route_id,route_short_name\nR,1\n")
+	writeTestFile(t, dir, "trips.txt", "route_id,service_id,trip_id\nR,S,t1\nR,S,t2\n")
+	writeTestFile(t, dir, "stop_times.txt", "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n"+
+		"t1,05:00:00,05:00:00,A,1\nt2,06:00:00,06:00:00,A,1\nt1,05:02:00,05:02:00,B,2\n")
+	if _, _, err := LoadStreamedFeed(dir); err == nil {
+		t.Fatal("expected an error for stop_times.txt not grouped by trip_id")
+	}
+}
+
+// peakHeap samples the heap in use while fn runs and returns its peak
+// above the heap in use before
+func peakHeap(fn func()) uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	read := func() uint64 {
+		metrics.Read(sample)
+		return sample[0].Value.Uint64()
+	}
+	runtime.GC()
+	before := read()
+	peak := before
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			if heap := read(); heap > peak {
+				peak = heap
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	fn()
+	close(done)
+	<-sampled
+	if heap := read(); heap > peak {
+		peak = heap
+	}
+	return peak - before
+}
+
+// BenchmarkLoadStreamedFeed compares the peak heap of loading a feed and
+// building its network with streamed stop times and with the full feed
+func BenchmarkLoadStreamedFeed(b *testing.B) {
+	const routes, tripsPerRoute, stopsPerTrip = 50, 200, 30
+	dir := b.TempDir()
+	writeSyntheticFeed(b, dir, routes, tripsPerRoute, stopsPerTrip)
+	loaders := []struct {
+		name string
+		load func() (*gtfs.Feed, StopTimeStreams, error)
+	}{
+		{"streamed", func() (*gtfs.Feed, StopTimeStreams, error) {
+			feed, streamed, err := LoadStreamedFeed(dir)
+			return feed, StopTimeStreams{dir: streamed}, err
+		}},
+		{"full", func() (*gtfs.Feed, StopTimeStreams, error) {
+			feed, err := loadFeed(dir)
+			return feed, nil, err
+		}},
+	}
+	for _, loader := range loaders {
+		b.Run(loader.name, func(b *testing.B) {
+			var heap uint64
+			for i := 0; i < b.N; i++ {
+				heap += peakHeap(func() {
+					feed, streams, err := loader.load()
+					if err != nil {
+						b.Fatal(err)
+					}
+					options := &Options{}
+					if err := options.Prepare(); err != nil {
+						b.Fatal(err)
+					}
+					_, _, err = GetNetwork(context.Background(), map[string]*gtfs.Feed{dir: feed}, nil, streams, options)
+					if err != nil {
+						b.Fatal(err)
+					}
+				})
+			}
+			b.ReportMetric(float64(heap)/float64(b.N)/(1<<20), "peak-heap-MB")
+			b.ReportMetric(float64(heap)/float64(b.N)/(routes*tripsPerRoute), "peak-heap-B/trip")
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/mapnificent/gogtfs"
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+const (
+	TRANSFER_RECOMMENDED = 0
+	// Departing vehicle waits for the arriving one
+	TRANSFER_TIMED = 1
+	// Transfer needs at least min_transfer_time seconds
+	TRANSFER_MIN_TIME  = 2
+	TRANSFER_FORBIDDEN = 3
+)
+
+// Transfer is a stop to stop row of transfers.txt
+type Transfer struct {
+	FromStopId      string
+	ToStopId        string
+	Type            int
+	MinTransferTime uint32
+}
+
+// readTransfers reads the stop to stop transfers of the feed at path
+// sorted by from and to stop. Rows restricted to routes or trips and in-seat
+// transfers cannot be expressed between Mapnificent stops and are skipped,
+// their number is logged to logger.
+func readTransfers(path string, logger *log.Logger) ([]Transfer, error) {
+	transfers := make([]Transfer, 0)
+	skipped := 0
+	_, err := readGtfsCsv(path, "transfers.txt", func(row map[string]string) error {
+		transferType, _ := strconv.Atoi(row["transfer_type"])
+		if transferType > TRANSFER_FORBIDDEN || row["from_stop_id"] == "" || row["to_stop_id"] == "" ||
+			row["from_route_id"] != "" || row["to_route_id"] != "" ||
+			row["from_trip_id"] != "" || row["to_trip_id"] != "" {
+			skipped += 1
+			return nil
+		}
+		minTransferTime, _ := strconv.ParseUint(row["min_transfer_time"], 10, 32)
+		transfers = append(transfers, Transfer{row["from_stop_id"], row["to_stop_id"], transferType, uint32(minTransferTime)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		logger.Println("Skipped", skipped, "route, trip or in-seat transfers in", path)
+	}
+	sort.SliceStable(transfers, func(i, j int) bool {
+		if transfers[i].FromStopId != transfers[j].FromStopId {
+			return transfers[i].FromStopId < transfers[j].FromStopId
+		}
+		return transfers[i].ToStopId < transfers[j].ToStopId
+	})
+	return transfers, nil
+}
+
+// resolvedTransfer combines the rows of transfers.txt between the stops
+// of one pair of Mapnificent stops
+type resolvedTransfer struct {
+	fromStop        *gtfs.Stop
+	toStop          *gtfs.Stop
+	forbidden       bool
+	guaranteed      bool
+	minTime         bool
+	minTransferTime uint32
+}
+
+func (r *resolvedTransfer) add(transfer Transfer) {
+	switch transfer.Type {
+	case TRANSFER_FORBIDDEN:
+		r.forbidden = true
+	case TRANSFER_TIMED:
+		r.guaranteed = true
+	case TRANSFER_MIN_TIME:
+		r.minTime = true
+		if transfer.MinTransferTime > r.minTransferTime {
+			r.minTransferTime = transfer.MinTransferTime
+		}
+	}
+}
+
+// ApplyTransfers replaces the walk options between the stops of the
+// transfers with explicit transfer options. Rows between stops merged into
+// the same pair of Mapnificent stops are combined: a forbidden transfer
+// only removes the walk option, otherwise the longest min_transfer_time
+// applies. Transfers between stops that end up in the same Mapnificent
+// stop are dropped. Stops not served by any line are only created for
+// transfers that add an option.
+func ApplyTransfers(path string, feed *gtfs.Feed, transfers []Transfer,
+	network *mapnificent.MapnificentNetwork,
+	stationMap map[string]uint,
+	clusters *StopClusters,
+	stopSources *StopSources,
+	walkGraph *WalkGraph,
+	options *Options) {
+	resolved := make(map[[2]string]*resolvedTransfer)
+	pairs := make([][2]string, 0)
+	for _, transfer := range transfers {
+		fromStop, fromOk := feed.Stops[transfer.FromStopId]
+		toStop, toOk := feed.Stops[transfer.ToStopId]
+		if !fromOk || !toOk {
+			continue
+		}
+		fromKey := transferStopKey(path, fromStop, stationMap, clusters)
+		toKey := transferStopKey(path, toStop, stationMap, clusters)
+		if fromKey == toKey {
+			continue
+		}
+		pair := [2]string{fromKey, toKey}
+		r, ok := resolved[pair]
+		if !ok {
+			r = &resolvedTransfer{fromStop: fromStop, toStop: toStop}
+			resolved[pair] = r
+			pairs = append(pairs, pair)
+		}
+		r.add(transfer)
+	}
+
+	for _, pair := range pairs {
+		r := resolved[pair]
+		if r.forbidden {
+			// Only stops that exist can have a walk between them
+			fromIndex, fromOk := FindMapnificentStop(path, r.fromStop, stationMap, clusters)
+			toIndex, toOk := FindMapnificentStop(path, r.toStop, stationMap, clusters)
+			if fromOk && toOk {
+				removeWalk(network.Stops[fromIndex], toIndex)
+			}
+			continue
+		}
+		fromIndex := GetOrCreateMapnificentStop(path, r.fromStop, network, stationMap, clusters, stopSources, options.ExtraInfo)
+		toIndex := GetOrCreateMapnificentStop(path, r.toStop, network, stationMap, clusters, stopSources, options.ExtraInfo)
+		mapnificentStop := network.Stops[fromIndex]
+		removeWalk(mapnificentStop, toIndex)
+
+		transferOption := new(mapnificent.MapnificentNetwork_Stop_TravelOption)
+		transferOption.Stop = uint32(toIndex)
+		SetWalk(transferOption, transferWalkDistance(walkGraph, r.fromStop, r.toStop, options), options)
+		if r.minTime {
+			transferOption.TravelTime = r.minTransferTime
+		}
+		transferOption.Guaranteed = r.guaranteed
+		mapnificentStop.TravelOptions = append(mapnificentStop.TravelOptions, transferOption)
+	}
+}
+
+// transferWalkDistance returns the walking distance between the stops of
+// a transfer along the streets of walkGraph, or the straight-line distance
+// times the walk detour where there is no street connection. A transfer
+// given by the feed is kept even if the streets do not connect both stops.
+func transferWalkDistance(walkGraph *WalkGraph, fromStop *gtfs.Stop, toStop *gtfs.Stop, options *Options) float64 {
+	straight := haversine(fromStop.Lat, fromStop.Lon, toStop.Lat, toStop.Lon)
+	if walkGraph != nil {
+		reach := walkGraph.Reach(fromStop.Lat, fromStop.Lon, straight*MAX_WALK_DETOUR)
+		distance, streets, connected := reach.Distance(toStop.Lat, toStop.Lon)
+		if streets && connected {
+			return distance
+		}
+	}
+	return straight * options.WalkDetour
+}
+
+// removeWalk removes the walk options of a stop to the stop at toIndex
+func removeWalk(mapnificentStop *mapnificent.MapnificentNetwork_Stop, toIndex uint) {
+	filterTravelOptions(mapnificentStop, func(travelOption *mapnificent.MapnificentNetwork_Stop_TravelOption) bool {
+		return !isWalk(travelOption) || travelOption.Stop != uint32(toIndex)
+	})
+}
+
+// transferStopKey identifies the Mapnificent stop a GTFS stop belongs to,
+// whether or not it has been created yet
+func transferStopKey(path string, stop *gtfs.Stop, stationMap map[string]uint, clusters *StopClusters) string {
+	if stopIndex, ok := FindMapnificentStop(path, stop, stationMap, clusters); ok {
+		return strconv.FormatUint(uint64(stopIndex), 10)
+	}
+	if cluster := clusters.Get(path, stop.Id); cluster != nil {
+		return cluster.Key
+	}
+	return fmt.Sprintf("%s_%s", path, stop.Id)
+}
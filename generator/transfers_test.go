@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+func TestTransfersCreateStopsForOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "calendar.txt", "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\nS,1,1,1,1,1,1,1,20260101,20261231\n")
+	// X and Y are not served by any trip and too far away for walks
+	writeTestFile(t, dir, "stops.txt", "stop_id,stop_name,stop_lat,stop_lon\nA,A,52.0,13.0\nB,B,52.01,13.0\nX,X,52.1,13.0\nY,Y,52.2,13.0\n")
+	writeTestFile(t, dir, "routes.txt", "route_id,route_short_name\nR,1\n")
+	writeTestFile(t, dir, "trips.txt", "route_id,service_id,trip_id\nR,S,t1\nR,S,t2\n")
+	writeTestFile(t, dir, "stop_times.txt", "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n"+
+		"t1,06:00:00,06:00:00,A,1\nt1,06:05:00,06:05:00,B,2\n"+
+		"t2,06:10:00,06:10:00,A,1\nt2,06:15:00,06:15:00,B,2\n")
+	writeTestFile(t, dir, "transfers.txt", "from_stop_id,to_stop_id,transfer_type,min_transfer_time\n"+
+		"B,X,3,\nA,Y,2,300\n")
+	feed, streamed, err := LoadStreamedFeed(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// GetNetwork fills in the defaults of the options
+	options := &Options{ExtraInfo: true}
+	network, _, err := GetNetwork(context.Background(), map[string]*gtfs.Feed{dir: feed}, nil, StopTimeStreams{dir: streamed}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stops := make(map[string]int)
+	for i, stop := range network.Stops {
+		stops[strings.Fields(stop.Name)[0]] = i
+	}
+	if _, ok := stops["X"]; ok {
+		t.Error("forbidden transfer created stop X")
+	}
+	y, ok := stops["Y"]
+	if !ok {
+		t.Fatal("transfer to Y did not create the stop")
+	}
+	found := false
+	for _, option := range network.Stops[stops["A"]].TravelOptions {
+		if option.Stop == uint32(y) && option.TravelTime == 300 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("missing transfer option from A to Y")
+	}
+}
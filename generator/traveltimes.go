@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"container/list"
+	"sort"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// segmentTimes holds travel and stay times of all trips between two
+// consecutive stops
+type segmentTimes struct {
+	travelTimes []int
+	stayTimes   []int
+}
+
+func segmentKey(fromStopId string, toStopId string) string {
+	return fromStopId + "||" + toStopId
+}
+
+// GetSegmentTimes collects for every LineTime the travel times between
+// consecutive stops of the trips it is based on, windowTrips as returned
+// by GetFrequencies
+func GetSegmentTimes(windowTrips []*list.List) []map[string]*segmentTimes {
+	windowSegments := make([]map[string]*segmentTimes, len(windowTrips))
+	for i, tripList := range windowTrips {
+		segments := make(map[string]*segmentTimes)
+		for trip := tripList.Front(); trip != nil; trip = trip.Next() {
+			realTrip := trip.Value.(*gtfs.Trip)
+			for j := 1; j < len(realTrip.StopTimes); j++ {
+				from := realTrip.StopTimes[j-1]
+				to := realTrip.StopTimes[j]
+				if to.ArrivalTime < from.DepartureTime || from.DepartureTime < from.ArrivalTime {
+					continue
+				}
+				key := segmentKey(from.Stop.Id, to.Stop.Id)
+				segment, ok := segments[key]
+				if !ok {
+					segment = new(segmentTimes)
+					segments[key] = segment
+				}
+				segment.travelTimes = append(segment.travelTimes, int(to.ArrivalTime-from.DepartureTime))
+				segment.stayTimes = append(segment.stayTimes, int(from.DepartureTime-from.ArrivalTime))
+			}
+		}
+		windowSegments[i] = segments
+	}
+	return windowSegments
+}
+
+// GetWindowTravelTimes returns the median travel and stay time between
+// two stops for every LineTime, falling back to the given times where no
+// trip of the window serves the segment. Both are nil if all windows
+// have the given times.
+func GetWindowTravelTimes(windowSegments []map[string]*segmentTimes, fromStopId string, toStopId string, travelTime uint32, stayTime uint32) (travelTimes []uint32, stayTimes []uint32) {
+	if len(windowSegments) == 0 {
+		return nil, nil
+	}
+	travelTimes = make([]uint32, len(windowSegments))
+	stayTimes = make([]uint32, len(windowSegments))
+	differs := false
+	key := segmentKey(fromStopId, toStopId)
+	for i, segments := range windowSegments {
+		travelTimes[i] = travelTime
+		stayTimes[i] = stayTime
+		if segment, ok := segments[key]; ok {
+			travelTimes[i] = uint32(median(segment.travelTimes))
+			stayTimes[i] = uint32(median(segment.stayTimes))
+		}
+		if travelTimes[i] != travelTime || stayTimes[i] != stayTime {
+			differs = true
+		}
+	}
+	if !differs {
+		return nil, nil
+	}
+	return travelTimes, stayTimes
+}
+
+func median(values []int) int {
+	sort.Ints(values)
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return round(float64(values[middle-1]+values[middle]) / 2)
+	}
+	return values[middle]
+}
@@ -0,0 +1,230 @@
+package generator
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"math"
+	"os"
+)
+
+const (
+	// Stops further away from the street network keep straight-line walks
+	WALK_SNAP_RADIUS = 100.0
+	// Walking paths may be this much longer than the walk radius
+	MAX_WALK_DETOUR = 2.0
+)
+
+// Highways that cannot be walked along
+var unwalkableHighways = map[string]bool{
+	"motorway":      true,
+	"motorway_link": true,
+	"trunk":         true,
+	"trunk_link":    true,
+	"construction":  true,
+	"proposed":      true,
+	"raceway":       true,
+	"bus_guideway":  true,
+	"abandoned":     true,
+}
+
+// BoundingBox limits which parts of an OSM extract are loaded
+type BoundingBox struct {
+	MinLat, MaxLat, MinLon, MaxLon float64
+}
+
+func (b BoundingBox) Contains(lat float64, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// Extend grows the box by meters in every direction
+func (b BoundingBox) Extend(meters float64) BoundingBox {
+	dLat := meters / EARTH_RADIUS * 180 / math.Pi
+	dLon := dLat / math.Cos(math.Max(math.Abs(b.MinLat), math.Abs(b.MaxLat))*math.Pi/180)
+	return BoundingBox{b.MinLat - dLat, b.MaxLat + dLat, b.MinLon - dLon, b.MaxLon + dLon}
+}
+
+type walkEdge struct {
+	to     int32
+	length float32
+}
+
+// WalkGraph is a pedestrian street network
+type WalkGraph struct {
+	lats  []float64
+	lons  []float64
+	edges [][]walkEdge
+	grid  *gridIndex
+}
+
+func isWalkable(tags map[string]string) bool {
+	highway, ok := tags["highway"]
+	if !ok || unwalkableHighways[highway] {
+		return false
+	}
+	foot := tags["foot"]
+	if foot == "no" {
+		return false
+	}
+	access := tags["access"]
+	if (access == "no" || access == "private") && foot != "yes" && foot != "designated" {
+		return false
+	}
+	return true
+}
+
+// LoadWalkGraph reads the walkable ways within bbox from an OSM PBF file.
+// ctx is checked before every block of the file is read, so cancelling
+// takes at most the decoding of one block of a few thousand nodes or ways.
+func LoadWalkGraph(ctx context.Context, path string, bbox BoundingBox, logger *log.Logger) (*WalkGraph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	type coordinate struct {
+		lat, lon float64
+	}
+	nodeCoordinates := make(map[int64]coordinate)
+	graph := &WalkGraph{}
+	nodeIndex := make(map[int64]int32)
+	getNode := func(id int64) (int32, bool) {
+		if index, ok := nodeIndex[id]; ok {
+			return index, true
+		}
+		c, ok := nodeCoordinates[id]
+		if !ok {
+			return 0, false
+		}
+		index := int32(len(graph.lats))
+		graph.lats = append(graph.lats, c.lat)
+		graph.lons = append(graph.lons, c.lon)
+		graph.edges = append(graph.edges, nil)
+		nodeIndex[id] = index
+		return index, true
+	}
+
+	err = readOSMPbf(contextReader{ctx, file}, func(id int64, lat float64, lon float64) {
+		if bbox.Contains(lat, lon) {
+			nodeCoordinates[id] = coordinate{lat, lon}
+		}
+	}, func(way *osmWay) {
+		if !isWalkable(way.Tags) {
+			return
+		}
+		for i := 1; i < len(way.Refs); i++ {
+			from, fromOk := getNode(way.Refs[i-1])
+			to, toOk := getNode(way.Refs[i])
+			if !fromOk || !toOk {
+				continue
+			}
+			length := float32(haversine(graph.lats[from], graph.lons[from], graph.lats[to], graph.lons[to]))
+			graph.edges[from] = append(graph.edges[from], walkEdge{to, length})
+			graph.edges[to] = append(graph.edges[to], walkEdge{from, length})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	graph.grid = newGridIndex(bbox, WALK_SNAP_RADIUS)
+	for i := range graph.lats {
+		graph.grid.Add(graph.lats[i], graph.lons[i], i)
+	}
+	logger.Println("Loaded walk graph with", len(graph.lats), "nodes from", path)
+	return graph, nil
+}
+
+// nearestNode returns the graph node closest to a coordinate within
+// WALK_SNAP_RADIUS
+func (g *WalkGraph) nearestNode(lat float64, lon float64) (node int32, distance float64, ok bool) {
+	distance = math.Inf(1)
+	g.grid.Nearby(lat, lon, 1, func(i int) {
+		d := haversine(lat, lon, g.lats[i], g.lons[i])
+		if d < distance || (d == distance && int32(i) < node) {
+			node = int32(i)
+			distance = d
+		}
+	})
+	return node, distance, distance <= WALK_SNAP_RADIUS
+}
+
+// WalkReach holds the walking distances from one place to the nodes of a
+// WalkGraph
+type WalkReach struct {
+	graph     *WalkGraph
+	lat       float64
+	lon       float64
+	snapped   bool
+	distances map[int32]float64
+}
+
+// Reach computes walking distances from a coordinate up to limit meters
+func (g *WalkGraph) Reach(lat float64, lon float64, limit float64) *WalkReach {
+	reach := &WalkReach{graph: g, lat: lat, lon: lon, distances: make(map[int32]float64)}
+	source, snapDistance, ok := g.nearestNode(lat, lon)
+	if !ok {
+		return reach
+	}
+	reach.snapped = true
+
+	queue := &walkQueue{{source, snapDistance}}
+	reach.distances[source] = snapDistance
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(walkQueueItem)
+		if item.distance > reach.distances[item.node] {
+			continue
+		}
+		for _, edge := range g.edges[item.node] {
+			distance := item.distance + float64(edge.length)
+			if distance > limit {
+				continue
+			}
+			if known, ok := reach.distances[edge.to]; ok && known <= distance {
+				continue
+			}
+			reach.distances[edge.to] = distance
+			heap.Push(queue, walkQueueItem{edge.to, distance})
+		}
+	}
+	return reach
+}
+
+// Distance returns the walking distance to a coordinate. If either end is
+// too far from the street network the straight-line distance is used and
+// streets is false, ok is false if the street network does not connect
+// both within limit.
+func (r *WalkReach) Distance(lat float64, lon float64) (distance float64, streets bool, ok bool) {
+	straight := haversine(r.lat, r.lon, lat, lon)
+	if !r.snapped {
+		return straight, false, true
+	}
+	target, snapDistance, snapped := r.graph.nearestNode(lat, lon)
+	if !snapped {
+		return straight, false, true
+	}
+	networkDistance, reached := r.distances[target]
+	if !reached {
+		return 0, false, false
+	}
+	return math.Max(networkDistance+snapDistance, straight), true, true
+}
+
+type walkQueueItem struct {
+	node     int32
+	distance float64
+}
+
+type walkQueue []walkQueueItem
+
+func (q walkQueue) Len() int            { return len(q) }
+func (q walkQueue) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q walkQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *walkQueue) Push(x interface{}) { *q = append(*q, x.(walkQueueItem)) }
+func (q *walkQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"context"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mapnificent/gogtfs"
+)
+
+// Stops W1 and W3 lie at both ends of a footway bending east through
+// node 2. E lies east of a motorway, which is not walkable and is the
+// only way joining it to the footway.
+var testWalkNodes = []testOSMNode{
+	{1, 52.000, 13.000},
+	{2, 52.001, 13.0012},
+	{3, 52.002, 13.000},
+	{5, 52.001, 13.003},
+	{6, 52.0015, 13.004},
+}
+
+var testWalkWays = []testOSMWay{
+	{100, []int64{1, 2, 3}, map[string]string{"highway": "footway"}},
+	{101, []int64{2, 5}, map[string]string{"highway": "motorway"}},
+	{102, []int64{5, 6}, map[string]string{"highway": "residential"}},
+}
+
+func writeTestWalkGraph(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "streets.osm.pbf")
+	if err := os.WriteFile(path, encodeTestPbf(testWalkNodes, testWalkWays), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWalkGraphDistance(t *testing.T) {
+	graph, err := LoadWalkGraph(context.Background(), writeTestWalkGraph(t), BoundingBox{51, 53, 12, 14}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reach := graph.Reach(52.000, 13.000, 1000)
+	distance, streets, ok := reach.Distance(52.002, 13.000)
+	want := haversine(52.000, 13.000, 52.001, 13.0012) + haversine(52.001, 13.0012, 52.002, 13.000)
+	if !ok || !streets || math.Abs(distance-want) > 0.5 {
+		t.Errorf("got distance %g (streets %v, connected %v), want %g along the footway", distance, streets, ok, want)
+	}
+	if _, _, ok := reach.Distance(52.001, 13.003); ok {
+		t.Error("expected the stop across the motorway not to be connected")
+	}
+	// Far from any street the straight line is used
+	distance, streets, ok = reach.Distance(52.01, 13.0)
+	if !ok || streets || math.Abs(distance-haversine(52.000, 13.000, 52.01, 13.0)) > 0.5 {
+		t.Errorf("got distance %g (streets %v, connected %v), want the straight line", distance, streets, ok)
+	}
+}
+
+func TestNetworkWalksAlongStreets(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "calendar.txt", "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\nS,1,1,1,1,1,1,1,20260101,20261231\n")
+	writeTestFile(t, dir, "stops.txt", "stop_id,stop_name,stop_lat,stop_lon\nW1,W1,52.000,13.000\nW3,W3,52.002,13.000\nE,E,52.001,13.003\n")
+	writeTestFile(t, dir, "routes.txt", "route_id,route_short_name\nR,1\n")
+	writeTestFile(t, dir, "trips.txt", "route_id,service_id,trip_id\nR,S,t1\nR,S,t2\n")
+	writeTestFile(t, dir, "stop_times.txt", "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n"+
+		"t1,06:00:00,06:00:00,W1,1\nt1,06:02:00,06:02:00,W3,2\nt1,06:05:00,06:05:00,E,3\n"+
+		"t2,06:10:00,06:10:00,W1,1\nt2,06:12:00,06:12:00,W3,2\nt2,06:15:00,06:15:00,E,3\n")
+	feed, streamed, err := LoadStreamedFeed(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := &Options{ExtraInfo: true, WalkDetour: 1.5, OSMFile: writeTestWalkGraph(t)}
+	if err := options.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	network, report, err := GetNetwork(context.Background(), map[string]*gtfs.Feed{dir: feed}, nil, StopTimeStreams{dir: streamed}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stops := make(map[string]uint32)
+	for i, stop := range network.Stops {
+		stops[strings.Fields(stop.Name)[0]] = uint32(i)
+	}
+	walks := make(map[[2]uint32]uint32)
+	for i, stop := range network.Stops {
+		for _, option := range stop.TravelOptions {
+			if option.Line == "" {
+				walks[[2]uint32{uint32(i), option.Stop}] = option.WalkDistance
+			}
+		}
+	}
+	if report.DroppedWalks == 0 {
+		t.Error("expected walks across the motorway to be dropped")
+	}
+	for _, from := range []string{"W1", "W3"} {
+		if _, ok := walks[[2]uint32{stops[from], stops["E"]}]; ok {
+			t.Errorf("walk from %s across the motorway kept", from)
+		}
+		if _, ok := walks[[2]uint32{stops["E"], stops[from]}]; ok {
+			t.Errorf("walk to %s across the motorway kept", from)
+		}
+	}
+	// The walk follows the bend of the footway, no detour factor applies
+	want := haversine(52.000, 13.000, 52.001, 13.0012) + haversine(52.001, 13.0012, 52.002, 13.000)
+	if got, ok := walks[[2]uint32{stops["W1"], stops["W3"]}]; !ok || got != uint32(want) {
+		t.Errorf("got walk distance %d (found %v) from W1 to W3, want %d", got, ok, uint32(want))
+	}
+}
@@ -0,0 +1,199 @@
+package generator
+
+import (
+	"sort"
+
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+// WalkPruning counts the walk options removed by PruneWalks
+type WalkPruning struct {
+	SameLines int
+	Dominated int
+	Nearest   int
+}
+
+func (p WalkPruning) Total() int {
+	return p.SameLines + p.Dominated + p.Nearest
+}
+
+// walkCost is the walk distance or time of a walk option, whichever is set
+func walkCost(travelOption *mapnificent.MapnificentNetwork_Stop_TravelOption) float64 {
+	if travelOption.WalkTime > 0 {
+		return float64(travelOption.WalkTime)
+	}
+	return float64(travelOption.WalkDistance)
+}
+
+// isWalk tells whether a travel option is a walk
+func isWalk(travelOption *mapnificent.MapnificentNetwork_Stop_TravelOption) bool {
+	return travelOption.Line == ""
+}
+
+// PruneWalks removes walk options of the network as configured, in this
+// order: walks between stops served by exactly the same lines, walks
+// dominated by a chain of two shorter walks that is at most
+// WalkChainFactor times as long, and all but the WalkNearest nearest walks
+// of every stop. Walks are expected in both directions, see
+// SymmetrizeWalks, and are removed in both directions together.
+func PruneWalks(network *mapnificent.MapnificentNetwork, options *Options) WalkPruning {
+	var pruning WalkPruning
+	if options.PruneSameLineWalks {
+		pruning.SameLines = pruneSameLineWalks(network)
+	}
+	if options.WalkChainFactor > 0 {
+		pruning.Dominated = pruneDominatedWalks(network, options.WalkChainFactor)
+	}
+	if options.WalkNearest > 0 {
+		pruning.Nearest = pruneFarWalks(network, options.WalkNearest)
+	}
+	if pruning.Total() > 0 {
+		options.Logger.Println("Pruned", pruning.Total(), "walks:", pruning.SameLines, "between stops of the same lines,",
+			pruning.Dominated, "dominated by shorter walks,", pruning.Nearest, "beyond the nearest")
+	}
+	return pruning
+}
+
+// removeWalkPairs removes the walks given as (from, to) stop indexes
+// together with their reverse walks and returns how many were removed
+func removeWalkPairs(network *mapnificent.MapnificentNetwork, walks map[[2]uint32]bool) int {
+	removed := 0
+	for i, mapnificentStop := range network.Stops {
+		removed += filterTravelOptions(mapnificentStop, func(travelOption *mapnificent.MapnificentNetwork_Stop_TravelOption) bool {
+			return !isWalk(travelOption) || !(walks[[2]uint32{uint32(i), travelOption.Stop}] || walks[[2]uint32{travelOption.Stop, uint32(i)}])
+		})
+	}
+	return removed
+}
+
+// filterTravelOptions keeps the travel options of a stop for which keep is
+// true and returns how many were removed
+func filterTravelOptions(mapnificentStop *mapnificent.MapnificentNetwork_Stop, keep func(travelOption *mapnificent.MapnificentNetwork_Stop_TravelOption) bool) int {
+	travelOptions := mapnificentStop.TravelOptions[:0]
+	for _, travelOption := range mapnificentStop.TravelOptions {
+		if keep(travelOption) {
+			travelOptions = append(travelOptions, travelOption)
+		}
+	}
+	removed := len(mapnificentStop.TravelOptions) - len(travelOptions)
+	mapnificentStop.TravelOptions = travelOptions
+	return removed
+}
+
+// pruneSameLineWalks removes walks between stops that are served by the
+// same set of lines, walking there never reaches another line
+func pruneSameLineWalks(network *mapnificent.MapnificentNetwork) int {
+	stopLines := make([]map[string]bool, len(network.Stops))
+	for i := range network.Stops {
+		stopLines[i] = make(map[string]bool)
+	}
+	for i, mapnificentStop := range network.Stops {
+		for _, travelOption := range mapnificentStop.TravelOptions {
+			if !isWalk(travelOption) {
+				stopLines[i][travelOption.Line] = true
+				stopLines[travelOption.Stop][travelOption.Line] = true
+			}
+		}
+	}
+	sameLines := func(a map[string]bool, b map[string]bool) bool {
+		if len(a) == 0 || len(a) != len(b) {
+			return false
+		}
+		for line := range a {
+			if !b[line] {
+				return false
+			}
+		}
+		return true
+	}
+	sameLineWalks := make(map[[2]uint32]bool)
+	for i, mapnificentStop := range network.Stops {
+		for _, travelOption := range mapnificentStop.TravelOptions {
+			if isWalk(travelOption) && sameLines(stopLines[i], stopLines[travelOption.Stop]) {
+				sameLineWalks[[2]uint32{uint32(i), travelOption.Stop}] = true
+			}
+		}
+	}
+	return removeWalkPairs(network, sameLineWalks)
+}
+
+// pruneDominatedWalks removes walks that can be replaced by two kept walks
+// at most factor times as long. Walks are decided from the shortest to the
+// longest, so a chain only consists of walks that are kept. A walk and its
+// reverse are decided together by the shorter of both.
+func pruneDominatedWalks(network *mapnificent.MapnificentNetwork, factor float64) int {
+	type walk struct {
+		from uint32
+		to   uint32
+		cost float64
+	}
+	walks := make([]walk, 0)
+	for i, mapnificentStop := range network.Stops {
+		for _, travelOption := range mapnificentStop.TravelOptions {
+			if isWalk(travelOption) {
+				walks = append(walks, walk{uint32(i), travelOption.Stop, walkCost(travelOption)})
+			}
+		}
+	}
+	sort.SliceStable(walks, func(i, j int) bool {
+		return walks[i].cost < walks[j].cost
+	})
+
+	kept := make(map[uint32]map[uint32]float64)
+	keep := func(from uint32, to uint32, cost float64) {
+		if kept[from] == nil {
+			kept[from] = make(map[uint32]float64)
+		}
+		kept[from][to] = cost
+	}
+	decided := make(map[[2]uint32]bool)
+	dominated := make(map[[2]uint32]bool)
+	for _, w := range walks {
+		if decided[[2]uint32{w.from, w.to}] {
+			continue
+		}
+		decided[[2]uint32{w.from, w.to}] = true
+		decided[[2]uint32{w.to, w.from}] = true
+		isDominated := false
+		for via, cost := range kept[w.from] {
+			if viaCost, ok := kept[via][w.to]; ok && cost+viaCost <= w.cost*factor {
+				isDominated = true
+				break
+			}
+		}
+		if isDominated {
+			dominated[[2]uint32{w.from, w.to}] = true
+			continue
+		}
+		keep(w.from, w.to, w.cost)
+		keep(w.to, w.from, w.cost)
+	}
+	return removeWalkPairs(network, dominated)
+}
+
+// pruneFarWalks keeps only the k shortest walks of every stop. A walk
+// beyond the k shortest of either of its stops is removed both ways.
+func pruneFarWalks(network *mapnificent.MapnificentNetwork, k int) int {
+	far := make(map[[2]uint32]bool)
+	for i, mapnificentStop := range network.Stops {
+		walks := make([]*mapnificent.MapnificentNetwork_Stop_TravelOption, 0)
+		for _, travelOption := range mapnificentStop.TravelOptions {
+			if isWalk(travelOption) {
+				walks = append(walks, travelOption)
+			}
+		}
+		if len(walks) <= k {
+			continue
+		}
+		sort.SliceStable(walks, func(i, j int) bool {
+			if walkCost(walks[i]) != walkCost(walks[j]) {
+				return walkCost(walks[i]) < walkCost(walks[j])
+			}
+			return walks[i].Stop < walks[j].Stop
+		})
+		for _, travelOption := range walks[k:] {
+			far[[2]uint32{uint32(i), travelOption.Stop}] = true
+		}
+	}
+	return removeWalkPairs(network, far)
+}
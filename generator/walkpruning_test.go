@@ -0,0 +1,78 @@
+package generator
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/mapnificent/mapnificent_generator/mapnificent.pb"
+)
+
+// testWalkNetwork returns stops along a line 100 m apart with walks from
+// the first stop to all others, and from every stop to its neighbours
+func testWalkNetwork(count int) *mapnificent.MapnificentNetwork {
+	network := &mapnificent.MapnificentNetwork{}
+	for i := 0; i < count; i++ {
+		network.Stops = append(network.Stops, &mapnificent.MapnificentNetwork_Stop{})
+	}
+	walk := func(from int, to int) {
+		distance := 100 * (to - from)
+		if distance < 0 {
+			distance = -distance
+		}
+		travelOption := &mapnificent.MapnificentNetwork_Stop_TravelOption{Stop: uint32(to), WalkDistance: uint32(distance)}
+		network.Stops[from].TravelOptions = append(network.Stops[from].TravelOptions, travelOption)
+	}
+	for i := 1; i < count; i++ {
+		walk(0, i)
+		if i > 1 {
+			walk(i-1, i)
+		}
+		walk(i, i-1)
+	}
+	return network
+}
+
+func networkWalks(network *mapnificent.MapnificentNetwork) map[[2]uint32]bool {
+	walks := make(map[[2]uint32]bool)
+	for i, mapnificentStop := range network.Stops {
+		for _, travelOption := range mapnificentStop.TravelOptions {
+			walks[[2]uint32{uint32(i), travelOption.Stop}] = true
+		}
+	}
+	return walks
+}
+
+func TestPruneWalksInPairs(t *testing.T) {
+	for _, options := range []*Options{{WalkNearest: 2}, {WalkChainFactor: 1.2}} {
+		network := testWalkNetwork(5)
+		added := SymmetrizeWalks(network)
+		// Stops 2 to 4 walk back to stop 0 after symmetrizing
+		if added != 3 {
+			t.Errorf("got %d reverse walks, want 3", added)
+		}
+		before := len(networkWalks(network))
+		options.Logger = log.New(io.Discard, "", 0)
+		pruning := PruneWalks(network, options)
+		walks := networkWalks(network)
+		if pruning.Total() != before-len(walks) {
+			t.Errorf("%+v: reported %d pruned walks, %d were removed", options, pruning.Total(), before-len(walks))
+		}
+		for walk := range walks {
+			if !walks[[2]uint32{walk[1], walk[0]}] {
+				t.Errorf("%+v: walk %v kept without its reverse", options, walk)
+			}
+		}
+		for i, mapnificentStop := range network.Stops {
+			if options.WalkNearest > 0 && len(mapnificentStop.TravelOptions) > options.WalkNearest {
+				t.Errorf("stop %d keeps %d walks, want at most %d", i, len(mapnificentStop.TravelOptions), options.WalkNearest)
+			}
+		}
+		// Only the walks between neighbours remain
+		for i := 1; i < len(network.Stops); i++ {
+			if !walks[[2]uint32{uint32(i - 1), uint32(i)}] {
+				t.Errorf("%+v: walk between neighbours %d and %d removed", options, i-1, i)
+			}
+		}
+	}
+}
@@ -64,6 +64,8 @@ type MapnificentNetwork_Stop struct {
 	Longitude     float64                                 `protobuf:"fixed64,2,opt,name=Longitude" json:"Longitude,omitempty"`
 	TravelOptions []*MapnificentNetwork_Stop_TravelOption `protobuf:"bytes,3,rep,name=TravelOptions" json:"TravelOptions,omitempty"`
 	Name          string                                  `protobuf:"bytes,4,opt,name=Name" json:"Name,omitempty"`
+	// GTFS stops merged into this stop
+	Sources []*MapnificentNetwork_Stop_Source `protobuf:"bytes,5,rep,name=Sources" json:"Sources,omitempty"`
 }
 
 func (m *MapnificentNetwork_Stop) Reset()                    { *m = MapnificentNetwork_Stop{} }
@@ -99,12 +101,34 @@ func (m *MapnificentNetwork_Stop) GetName() string {
 	return ""
 }
 
+func (m *MapnificentNetwork_Stop) GetSources() []*MapnificentNetwork_Stop_Source {
+	if m != nil {
+		return m.Sources
+	}
+	return nil
+}
+
 type MapnificentNetwork_Stop_TravelOption struct {
 	Stop         uint32 `protobuf:"varint,1,opt,name=Stop" json:"Stop,omitempty"`
 	TravelTime   uint32 `protobuf:"varint,2,opt,name=TravelTime" json:"TravelTime,omitempty"`
 	StayTime     uint32 `protobuf:"varint,3,opt,name=StayTime" json:"StayTime,omitempty"`
 	Line         string `protobuf:"bytes,4,opt,name=Line" json:"Line,omitempty"`
 	WalkDistance uint32 `protobuf:"varint,5,opt,name=WalkDistance" json:"WalkDistance,omitempty"`
+	// Interval of the line at the stop this option departs from for
+	// each LineTime of the line (same order), 0 if there is no regular
+	// service at the stop. Empty if equal to the LineTime intervals.
+	StopIntervals []uint32 `protobuf:"varint,6,rep,packed,name=StopIntervals" json:"StopIntervals,omitempty"`
+	// Median travel and stay time of the trips in each LineTime of the
+	// line (same order). Empty if equal to TravelTime and StayTime.
+	TravelTimes []uint32 `protobuf:"varint,7,rep,packed,name=TravelTimes" json:"TravelTimes,omitempty"`
+	StayTimes   []uint32 `protobuf:"varint,8,rep,packed,name=StayTimes" json:"StayTimes,omitempty"`
+	// Walking time in seconds, set instead of WalkDistance when a
+	// walking speed is configured
+	WalkTime uint32 `protobuf:"varint,9,opt,name=WalkTime" json:"WalkTime,omitempty"`
+	// Transfer from transfers.txt where the departing vehicle waits for
+	// the arriving one. Transfers with a minimum transfer time have it
+	// as TravelTime.
+	Guaranteed bool `protobuf:"varint,10,opt,name=Guaranteed" json:"Guaranteed,omitempty"`
 }
 
 func (m *MapnificentNetwork_Stop_TravelOption) Reset()         { *m = MapnificentNetwork_Stop_TravelOption{} }
@@ -149,10 +173,92 @@ func (m *MapnificentNetwork_Stop_TravelOption) GetWalkDistance() uint32 {
 	return 0
 }
 
+func (m *MapnificentNetwork_Stop_TravelOption) GetStopIntervals() []uint32 {
+	if m != nil {
+		return m.StopIntervals
+	}
+	return nil
+}
+
+func (m *MapnificentNetwork_Stop_TravelOption) GetTravelTimes() []uint32 {
+	if m != nil {
+		return m.TravelTimes
+	}
+	return nil
+}
+
+func (m *MapnificentNetwork_Stop_TravelOption) GetStayTimes() []uint32 {
+	if m != nil {
+		return m.StayTimes
+	}
+	return nil
+}
+
+func (m *MapnificentNetwork_Stop_TravelOption) GetWalkTime() uint32 {
+	if m != nil {
+		return m.WalkTime
+	}
+	return 0
+}
+
+func (m *MapnificentNetwork_Stop_TravelOption) GetGuaranteed() bool {
+	if m != nil {
+		return m.Guaranteed
+	}
+	return false
+}
+
+type MapnificentNetwork_Stop_Source struct {
+	// File or directory name of the feed
+	FeedId   string `protobuf:"bytes,1,opt,name=FeedId" json:"FeedId,omitempty"`
+	StopId   string `protobuf:"bytes,2,opt,name=StopId" json:"StopId,omitempty"`
+	StopName string `protobuf:"bytes,3,opt,name=StopName" json:"StopName,omitempty"`
+	StopCode string `protobuf:"bytes,4,opt,name=StopCode" json:"StopCode,omitempty"`
+}
+
+func (m *MapnificentNetwork_Stop_Source) Reset()         { *m = MapnificentNetwork_Stop_Source{} }
+func (m *MapnificentNetwork_Stop_Source) String() string { return proto.CompactTextString(m) }
+func (*MapnificentNetwork_Stop_Source) ProtoMessage()    {}
+func (*MapnificentNetwork_Stop_Source) Descriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{0, 0, 1}
+}
+
+func (m *MapnificentNetwork_Stop_Source) GetFeedId() string {
+	if m != nil {
+		return m.FeedId
+	}
+	return ""
+}
+
+func (m *MapnificentNetwork_Stop_Source) GetStopId() string {
+	if m != nil {
+		return m.StopId
+	}
+	return ""
+}
+
+func (m *MapnificentNetwork_Stop_Source) GetStopName() string {
+	if m != nil {
+		return m.StopName
+	}
+	return ""
+}
+
+func (m *MapnificentNetwork_Stop_Source) GetStopCode() string {
+	if m != nil {
+		return m.StopCode
+	}
+	return ""
+}
+
 type MapnificentNetwork_Line struct {
 	LineId    string                              `protobuf:"bytes,1,opt,name=LineId" json:"LineId,omitempty"`
 	LineTimes []*MapnificentNetwork_Line_LineTime `protobuf:"bytes,2,rep,name=LineTimes" json:"LineTimes,omitempty"`
 	Name      string                              `protobuf:"bytes,3,opt,name=Name" json:"Name,omitempty"`
+	// Hourly profile mode: run-length encoded pairs of (hours, interval)
+	// covering the week hour by hour from Monday 00:00, interval 0 means
+	// no service in these hours
+	HourlyIntervals []uint32 `protobuf:"varint,4,rep,packed,name=HourlyIntervals" json:"HourlyIntervals,omitempty"`
 }
 
 func (m *MapnificentNetwork_Line) Reset()                    { *m = MapnificentNetwork_Line{} }
@@ -181,11 +287,24 @@ func (m *MapnificentNetwork_Line) GetName() string {
 	return ""
 }
 
+func (m *MapnificentNetwork_Line) GetHourlyIntervals() []uint32 {
+	if m != nil {
+		return m.HourlyIntervals
+	}
+	return nil
+}
+
 type MapnificentNetwork_Line_LineTime struct {
 	Interval uint32 `protobuf:"varint,1,opt,name=Interval" json:"Interval,omitempty"`
 	Start    uint32 `protobuf:"varint,2,opt,name=Start" json:"Start,omitempty"`
 	Stop     uint32 `protobuf:"varint,3,opt,name=Stop" json:"Stop,omitempty"`
 	Weekday  uint32 `protobuf:"varint,4,opt,name=Weekday" json:"Weekday,omitempty"`
+	// Expected waiting time in seconds for irregular departures
+	ExpectedWait uint32 `protobuf:"varint,5,opt,name=ExpectedWait" json:"ExpectedWait,omitempty"`
+	// Longest gap between departures in seconds
+	MaxGap uint32 `protobuf:"varint,6,opt,name=MaxGap" json:"MaxGap,omitempty"`
+	// Number of trips in the window
+	TripCount uint32 `protobuf:"varint,7,opt,name=TripCount" json:"TripCount,omitempty"`
 }
 
 func (m *MapnificentNetwork_Line_LineTime) Reset()         { *m = MapnificentNetwork_Line_LineTime{} }
@@ -223,10 +342,32 @@ func (m *MapnificentNetwork_Line_LineTime) GetWeekday() uint32 {
 	return 0
 }
 
+func (m *MapnificentNetwork_Line_LineTime) GetExpectedWait() uint32 {
+	if m != nil {
+		return m.ExpectedWait
+	}
+	return 0
+}
+
+func (m *MapnificentNetwork_Line_LineTime) GetMaxGap() uint32 {
+	if m != nil {
+		return m.MaxGap
+	}
+	return 0
+}
+
+func (m *MapnificentNetwork_Line_LineTime) GetTripCount() uint32 {
+	if m != nil {
+		return m.TripCount
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*MapnificentNetwork)(nil), "mapnificent.MapnificentNetwork")
 	proto.RegisterType((*MapnificentNetwork_Stop)(nil), "mapnificent.MapnificentNetwork.Stop")
 	proto.RegisterType((*MapnificentNetwork_Stop_TravelOption)(nil), "mapnificent.MapnificentNetwork.Stop.TravelOption")
+	proto.RegisterType((*MapnificentNetwork_Stop_Source)(nil), "mapnificent.MapnificentNetwork.Stop.Source")
 	proto.RegisterType((*MapnificentNetwork_Line)(nil), "mapnificent.MapnificentNetwork.Line")
 	proto.RegisterType((*MapnificentNetwork_Line_LineTime)(nil), "mapnificent.MapnificentNetwork.Line.LineTime")
 }
@@ -234,28 +375,39 @@ func init() {
 func init() { proto.RegisterFile("mapnificent.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 365 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x52, 0xc1, 0x4e, 0xf2, 0x40,
-	0x10, 0x4e, 0x29, 0xf0, 0xc3, 0x40, 0x0f, 0xff, 0xc6, 0x98, 0xa6, 0x31, 0x86, 0x10, 0x0f, 0x5c,
-	0x6c, 0xa2, 0xde, 0xbc, 0xea, 0x85, 0x88, 0x98, 0x2c, 0x24, 0x9c, 0x57, 0x58, 0xcd, 0x0a, 0x6c,
-	0x9b, 0x32, 0x62, 0x78, 0x11, 0x1f, 0xc9, 0x97, 0xf0, 0x11, 0x7c, 0x09, 0x33, 0xbb, 0x74, 0x59,
-	0xe2, 0xa5, 0xa7, 0xce, 0x37, 0x33, 0xdf, 0xd7, 0x99, 0x6f, 0x16, 0xfe, 0xaf, 0x45, 0xae, 0xd5,
-	0x8b, 0x9a, 0x4b, 0x8d, 0x69, 0x5e, 0x64, 0x98, 0xb1, 0x8e, 0x97, 0xea, 0x7f, 0x37, 0x80, 0x3d,
-	0x1e, 0xf0, 0x58, 0xe2, 0x47, 0x56, 0x2c, 0xd9, 0x29, 0x34, 0xef, 0x14, 0xee, 0xd4, 0x22, 0x0e,
-	0x7a, 0xc1, 0xa0, 0xcd, 0xf7, 0x88, 0xdd, 0x42, 0x63, 0x82, 0x59, 0xbe, 0x89, 0x6b, 0xbd, 0x70,
-	0xd0, 0xb9, 0xbe, 0x48, 0x7d, 0xf9, 0xbf, 0x3a, 0x29, 0x35, 0x73, 0x4b, 0x21, 0xee, 0x48, 0x69,
-	0xb9, 0x89, 0xc3, 0x6a, 0x5c, 0x6a, 0xe6, 0x96, 0x92, 0x7c, 0xd5, 0xa0, 0x4e, 0x2a, 0x2c, 0x81,
-	0xd6, 0x48, 0xa0, 0xc2, 0xf7, 0x85, 0x34, 0xa3, 0x05, 0xdc, 0x61, 0x76, 0x06, 0xed, 0x51, 0xa6,
-	0x5f, 0x6d, 0xb1, 0x66, 0x8a, 0x87, 0x04, 0x9b, 0x41, 0x34, 0x2d, 0xc4, 0x56, 0xae, 0x9e, 0x72,
-	0x54, 0x99, 0x2e, 0xc7, 0xb8, 0xaa, 0xb2, 0x42, 0xea, 0x33, 0xf9, 0xb1, 0x0e, 0x63, 0x50, 0x1f,
-	0x8b, 0xb5, 0x8c, 0xeb, 0xc6, 0x29, 0x13, 0x27, 0x9f, 0x01, 0x74, 0xfd, 0x2e, 0x6a, 0x22, 0x21,
-	0x33, 0x73, 0xc4, 0xed, 0x2e, 0xe7, 0x00, 0xb6, 0x67, 0xaa, 0xd6, 0x76, 0xe0, 0x88, 0x7b, 0x19,
-	0xda, 0x75, 0x82, 0x62, 0x67, 0xaa, 0xa1, 0xa9, 0x3a, 0x4c, 0x7a, 0xe4, 0x4c, 0xf9, 0x53, 0x8a,
-	0x59, 0x1f, 0xba, 0x33, 0xb1, 0x5a, 0xde, 0xab, 0x0d, 0x0a, 0x3d, 0x97, 0x71, 0xc3, 0x70, 0x8e,
-	0x72, 0xc9, 0x4f, 0x60, 0x89, 0x74, 0x61, 0xfa, 0x0e, 0xdd, 0x85, 0x2d, 0x62, 0x0f, 0xd0, 0xa6,
-	0x88, 0x7e, 0x52, 0x5e, 0xf9, 0xb2, 0xca, 0xa5, 0xd2, 0x92, 0xc5, 0x0f, 0x7c, 0x67, 0x4d, 0xe8,
-	0x59, 0xf3, 0x06, 0xad, 0xb2, 0x81, 0x36, 0x1c, 0x6a, 0x94, 0xc5, 0x56, 0xac, 0xf6, 0xce, 0x38,
-	0xcc, 0x4e, 0xe8, 0xa9, 0x89, 0x02, 0xf7, 0xc6, 0x58, 0xe0, 0x7c, 0x0c, 0x3d, 0x1f, 0x63, 0xf8,
-	0x37, 0x93, 0x72, 0xb9, 0x10, 0x3b, 0x63, 0x47, 0xc4, 0x4b, 0xf8, 0xdc, 0x34, 0x2f, 0xfe, 0xe6,
-	0x37, 0x00, 0x00, 0xff, 0xff, 0x1e, 0xe3, 0xae, 0xff, 0x06, 0x03, 0x00, 0x00,
+	// 542 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0xdd, 0x8a, 0xd3, 0x40,
+	0x14, 0xa6, 0x4d, 0xff, 0x72, 0xba, 0x41, 0x1c, 0x44, 0x86, 0x20, 0x52, 0x96, 0xbd, 0x28, 0x88,
+	0x05, 0xf5, 0xce, 0xdb, 0xba, 0xae, 0x8b, 0xdd, 0x0a, 0xd3, 0x42, 0xaf, 0xc7, 0x66, 0x94, 0xa1,
+	0x6d, 0x26, 0x24, 0x93, 0x75, 0xfb, 0x38, 0xbe, 0x85, 0xe0, 0xad, 0x0f, 0xe4, 0x23, 0xc8, 0x39,
+	0x93, 0x49, 0x52, 0xf7, 0xa6, 0x57, 0x9d, 0xef, 0x3b, 0x73, 0xfe, 0xbe, 0x7c, 0x53, 0x78, 0x7a,
+	0x90, 0x59, 0xaa, 0xbf, 0xe9, 0xad, 0x4a, 0xed, 0x2c, 0xcb, 0x8d, 0x35, 0x6c, 0xdc, 0xa2, 0x2e,
+	0x7f, 0x87, 0xc0, 0xee, 0x1a, 0xbc, 0x54, 0xf6, 0x87, 0xc9, 0x77, 0xec, 0x39, 0x0c, 0xe6, 0xda,
+	0x1e, 0x75, 0xc2, 0x3b, 0x93, 0xce, 0x34, 0x14, 0x15, 0x62, 0xef, 0xa1, 0xbf, 0xb2, 0x26, 0x2b,
+	0x78, 0x77, 0x12, 0x4c, 0xc7, 0x6f, 0xaf, 0x66, 0xed, 0xf2, 0x8f, 0xeb, 0xcc, 0xf0, 0xb2, 0x70,
+	0x29, 0x98, 0xbb, 0xd0, 0xa9, 0x2a, 0x78, 0x70, 0x5e, 0x2e, 0x5e, 0x16, 0x2e, 0x25, 0xfe, 0xd9,
+	0x87, 0x1e, 0x56, 0x61, 0x31, 0x8c, 0x16, 0xd2, 0x6a, 0x5b, 0x26, 0x8a, 0x46, 0xeb, 0x88, 0x1a,
+	0xb3, 0x17, 0x10, 0x2e, 0x4c, 0xfa, 0xdd, 0x05, 0xbb, 0x14, 0x6c, 0x08, 0xb6, 0x81, 0x68, 0x9d,
+	0xcb, 0x7b, 0xb5, 0xff, 0x92, 0x59, 0x6d, 0x52, 0x3f, 0xc6, 0x9b, 0x73, 0x56, 0x98, 0xb5, 0x33,
+	0xc5, 0x69, 0x1d, 0xc6, 0xa0, 0xb7, 0x94, 0x07, 0xc5, 0x7b, 0xa4, 0x14, 0x9d, 0xd9, 0x35, 0x0c,
+	0x57, 0xa6, 0xcc, 0xb7, 0xaa, 0xe0, 0x7d, 0x6a, 0xf3, 0xea, 0xac, 0x36, 0x2e, 0x47, 0xf8, 0xdc,
+	0xf8, 0x57, 0x17, 0x2e, 0xda, 0xcd, 0xb0, 0x17, 0x5e, 0xa4, 0xd5, 0x23, 0x41, 0x67, 0xf6, 0x12,
+	0xc0, 0xdd, 0x59, 0xeb, 0x83, 0xdb, 0x3b, 0x12, 0x2d, 0x06, 0x25, 0x5b, 0x59, 0x79, 0xa4, 0x68,
+	0x40, 0xd1, 0x1a, 0x63, 0x3d, 0x14, 0xd8, 0xcf, 0x8e, 0x67, 0x76, 0x09, 0x17, 0x1b, 0xb9, 0xdf,
+	0x7d, 0xd0, 0x85, 0x95, 0xe9, 0x56, 0xf1, 0x3e, 0xe5, 0x9c, 0x70, 0xec, 0x0a, 0x22, 0xec, 0x7d,
+	0x9b, 0x5a, 0x95, 0xdf, 0xcb, 0x7d, 0xc1, 0x07, 0x93, 0x60, 0x1a, 0x89, 0x53, 0x92, 0x4d, 0x60,
+	0xdc, 0xcc, 0x51, 0xf0, 0x21, 0xdd, 0x69, 0x53, 0xf8, 0xc9, 0xfc, 0x2c, 0x05, 0x1f, 0x51, 0xbc,
+	0x21, 0x70, 0x72, 0xec, 0x4a, 0x93, 0x87, 0x6e, 0x72, 0x8f, 0x71, 0xeb, 0x9b, 0x52, 0xe6, 0x32,
+	0xb5, 0x4a, 0x25, 0x1c, 0x26, 0x9d, 0xe9, 0x48, 0xb4, 0x98, 0x38, 0x83, 0x81, 0x53, 0x11, 0xbd,
+	0xfc, 0x51, 0xa9, 0xe4, 0xb6, 0xf6, 0xb2, 0x43, 0xc8, 0xd3, 0xb8, 0x09, 0x69, 0x16, 0x8a, 0x0a,
+	0x39, 0xbd, 0x4c, 0xb6, 0x94, 0x95, 0x5e, 0xa1, 0xa8, 0xb1, 0x8f, 0xcd, 0x4d, 0xe2, 0x35, 0xab,
+	0x71, 0xfc, 0xb7, 0xeb, 0xc4, 0xc4, 0xc2, 0xf8, 0xdb, 0x34, 0x74, 0x88, 0x7d, 0x86, 0x10, 0x4f,
+	0x6e, 0x59, 0xf7, 0x80, 0x5e, 0x9f, 0xf3, 0x08, 0x66, 0x3e, 0x4b, 0x34, 0xf9, 0xb5, 0xeb, 0x82,
+	0x96, 0xeb, 0xa6, 0xf0, 0xe4, 0x93, 0x29, 0xf3, 0xfd, 0xb1, 0xf9, 0x2e, 0x3d, 0xd2, 0xf4, 0x7f,
+	0x3a, 0xfe, 0xd3, 0x81, 0x91, 0xaf, 0x85, 0x4b, 0xf9, 0x48, 0x65, 0xac, 0x1a, 0xb3, 0x67, 0xf8,
+	0xe0, 0x65, 0x6e, 0x2b, 0x5f, 0x39, 0x50, 0xdb, 0x30, 0x68, 0xd9, 0x90, 0xc3, 0x70, 0xa3, 0xd4,
+	0x2e, 0x91, 0x47, 0x52, 0x26, 0x12, 0x1e, 0xa2, 0xa1, 0xae, 0x1f, 0x32, 0xb5, 0xb5, 0x2a, 0xd9,
+	0x48, 0x6d, 0xbd, 0xa1, 0xda, 0x1c, 0x6a, 0x76, 0x27, 0x1f, 0x6e, 0x64, 0xc6, 0x07, 0x14, 0xad,
+	0x10, 0x1a, 0x64, 0x9d, 0xeb, 0x6c, 0x6e, 0xca, 0xd4, 0xf2, 0x21, 0x85, 0x1a, 0xe2, 0xeb, 0x80,
+	0xfe, 0xd1, 0xde, 0xfd, 0x1b, 0x00, 0xa0, 0x1f, 0xfe, 0x51, 0xe6, 0x04, 0x00, 0x00,
 }